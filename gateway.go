@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/qq51529210/gateway/handler"
 	router "github.com/qq51529210/http-router"
@@ -42,8 +44,16 @@ type NewGatewayData struct {
 	Intercept []NewHandlerData `json:"intercept"`
 	// Gateway notFound handler call chain.
 	NotFound []NewHandlerData `json:"notFound"`
-	// Gateway forward handler call chain.
-	Forward map[string][]NewHandlerData `json:"forward"`
+	// Gateway forward routes,key is route name.
+	Forward map[string]*NewForwardData `json:"forward"`
+	// Client ip resolver,trusted proxies and headers.
+	ClientIP *handler.ClientIPData `json:"clientIP"`
+	// Named shared upstream transports,key is name.
+	// Forwarders can use them by "transportName".
+	Transport map[string]*handler.TransportData `json:"transport"`
+	// Virtual hosts,key is host name like "a.example.com" or "*.example.com".
+	// Request which host is not matched will use the gateway chains and routes above.
+	Host map[string]*NewHostData `json:"host"`
 	// API management server listen address.
 	// If ApiX509CertPEM and ApiX509KeyPEM both are not empty,api server will use TLS.
 	ApiListen string `json:"apiListen"`
@@ -55,11 +65,6 @@ type NewGatewayData struct {
 	ApiAccessToken string `json:"apiAccessToken"`
 }
 
-type gatewayForwarder struct {
-	RegisterName string
-	handler.Handler
-}
-
 // Create a new Gateway
 func NewGateway(data *NewGatewayData) (*Gateway, error) {
 	var err error
@@ -72,16 +77,28 @@ func NewGateway(data *NewGatewayData) (*Gateway, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Client ip resolver and PROXY protocol.
+	err = handler.SetClientIPResolver(data.ClientIP)
+	if err != nil {
+		return nil, err
+	}
+	if data.ClientIP != nil && data.ClientIP.ProxyProtocol {
+		listener, err = handler.NewProxyProtocolListener(listener, data.ClientIP.TrustedProxy)
+		if err != nil {
+			return nil, err
+		}
+	}
 	// Gateway http server use TLS?
 	if data.X509CertPEM != "" && data.X509KeyPEM != "" {
 		certificate, err := tls.X509KeyPair([]byte(data.X509CertPEM), []byte(data.X509KeyPEM))
 		if err != nil {
 			return nil, err
 		}
-		gw.listener = tls.NewListener(listener, &tls.Config{
+		listener = tls.NewListener(listener, &tls.Config{
 			Certificates: []tls.Certificate{certificate},
 		})
 	}
+	gw.listener = listener
 	// Api http server use TLS?
 	if data.ApiListen != "" {
 		listener, err = net.Listen("tcp", data.ApiListen)
@@ -93,28 +110,44 @@ func NewGateway(data *NewGatewayData) (*Gateway, error) {
 			if err != nil {
 				return nil, err
 			}
-			gw.apiListener = tls.NewListener(listener, &tls.Config{
+			listener = tls.NewListener(listener, &tls.Config{
 				Certificates: []tls.Certificate{certificate},
 			})
 		}
+		gw.apiListener = listener
+	}
+	// Init shared transports before handlers use them.
+	for k, v := range data.Transport {
+		err = handler.SetTransport(k, v)
+		if err != nil {
+			return nil, err
+		}
 	}
+	gw.host = newVirtualHost("")
 	// Init intercept handler call chain.
-	err = gw.newIntercept(data.Intercept)
+	err = gw.host.newIntercept(data.Intercept)
 	if err != nil {
 		return nil, err
 	}
 	// Init notfound handler call chain.
-	err = gw.newNotFound(data.NotFound)
+	err = gw.host.newNotFound(data.NotFound)
 	if err != nil {
 		return nil, err
 	}
-	// Init forward handler call chain.
+	// Init forward routes.
 	for k, v := range data.Forward {
-		err = gw.newForward(k, v)
+		err = gw.host.newForward(k, v)
 		if err != nil {
 			return nil, err
 		}
 	}
+	// Init virtual hosts.
+	gw.hosts = make(map[string]*virtualHost)
+	gw.hostTable.Store(newHostTable(gw.hosts))
+	err = gw.newHost(data.Host)
+	if err != nil {
+		return nil, err
+	}
 	return gw, nil
 }
 
@@ -129,55 +162,21 @@ type Gateway struct {
 	apiListener net.Listener
 	// Api server token
 	apiToken string
-	// Gateway intercept chain.
-	intercept []handler.Handler
-	// Gateway notfound chain.
-	notfound []handler.Handler
-	// Gateway forward chain,key is route and value is *gatewayForwarder.
-	forward sync.Map
+	// Default host chains and routes.
+	host *virtualHost
+	// Virtual hosts,key is host name.
+	hosts map[string]*virtualHost
+	// Lock for hosts.
+	hostLock sync.Mutex
+	// Virtual hosts lookup table,value is *hostTable.
+	hostTable atomic.Value
 }
 
 func (gw *Gateway) Serve() error {
-	// Default interceptor handler.
-	if len(gw.intercept) == 0 {
-		gw.intercept = []handler.Handler{new(handler.DefaultInterceptor)}
-	}
-	// Default notFound handler.
-	if len(gw.notfound) == 0 {
-		gw.notfound = []handler.Handler{new(handler.DefaultNotFound)}
-	}
-	// Set handler function.
-	gw.server.Handler = http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-		ctx := contextPool.Get().(*handler.Context)
-		ctx.Req = req
-		ctx.Res = res
-		ctx.Data = nil
-		// Intercept  chain.
-		for _, h := range gw.intercept {
-			if !h.Handle(ctx) {
-				contextPool.Put(ctx)
-				return
-			}
-		}
-		ctx.Path = handler.TopDir(req.URL.Path)
-		value, ok := gw.forward.Load(ctx.Path)
-		if !ok {
-			// NotFound chain.
-			for _, h := range gw.notfound {
-				if !h.Handle(ctx) {
-					break
-				}
-			}
-		} else {
-			// Forward chain.
-			for _, h := range value.([]handler.Handler) {
-				if !h.Handle(ctx) {
-					break
-				}
-			}
-		}
-		contextPool.Put(ctx)
-	})
+	// Default handlers.
+	gw.host.setDefault()
+	// Set handler.
+	gw.server.Handler = gw
 	// Start serve
 	return gw.server.Serve(gw.listener)
 }
@@ -189,74 +188,74 @@ func (gw *Gateway) Close() error {
 	return nil
 }
 
-// Setup forwarder chain.
-func (gw *Gateway) newForward(route string, data []NewHandlerData) error {
-	route = handler.TopDir(route)
-	if route == "" {
-		return errors.New(`"forward"."route" must define`)
+// Serve gateway request.
+func (gw *Gateway) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	ctx := contextPool.Get().(*handler.Context)
+	ctx.Reset(res, req)
+	host := gw.hostTable.Load().(*hostTable).Match(req)
+	if host == nil {
+		host = gw.host
 	}
-	if route[0] != '/' {
-		route = "/" + route
-	}
-	if len(data) == 0 {
-		return errors.New(`"forward"."route[%s]" must define handler`)
-	}
-	forward := make([]*gatewayForwarder, 0)
-	for i, a := range data {
-		hd, err := handler.NewHandler(a.Name, a.Data)
+	host.Handle(ctx)
+	ctx.RunDefer()
+	contextPool.Put(ctx)
+}
+
+// Setup virtual hosts.
+// If value of data is nil,remove the host.
+func (gw *Gateway) newHost(data map[string]*NewHostData) error {
+	hosts := make(map[string]*virtualHost)
+	for k, v := range data {
+		if v == nil {
+			hosts[strings.ToLower(k)] = nil
+			continue
+		}
+		h, err := newVirtualHostWithData(k, v)
 		if err != nil {
-			return fmt.Errorf(`"forward[%d]" %s`, i, err.Error())
+			for _, h := range hosts {
+				if h != nil {
+					h.Release()
+				}
+			}
+			return err
 		}
-		forward = append(forward, &gatewayForwarder{
-			RegisterName: a.Name,
-			Handler:      hd,
-		})
+		hosts[h.name] = h
 	}
-	value, ok := gw.forward.LoadOrStore(route, forward)
-	if ok {
-		for _, h := range value.([]*gatewayForwarder) {
-			h.Release()
+	old := make([]*virtualHost, 0)
+	gw.hostLock.Lock()
+	for k, v := range hosts {
+		if h, ok := gw.hosts[k]; ok {
+			old = append(old, h)
+		}
+		if v == nil {
+			delete(gw.hosts, k)
+		} else {
+			gw.hosts[k] = v
 		}
 	}
-	return nil
-}
-
-// Setup iterceptor chain.
-func (gw *Gateway) newIntercept(data []NewHandlerData) error {
-	if len(data) == 0 {
-		return errors.New(`"itercept" must define handler`)
-	}
-	for _, h := range gw.intercept {
+	gw.hostTable.Store(newHostTable(gw.hosts))
+	gw.hostLock.Unlock()
+	for _, h := range old {
 		h.Release()
 	}
-	gw.intercept = make([]handler.Handler, 0)
-	for i, a := range data {
-		hd, err := handler.NewHandler(a.Name, a.Data)
-		if err != nil {
-			return fmt.Errorf(`"itercept[%d]" %s`, i, err.Error())
-		}
-		gw.intercept = append(gw.intercept, hd)
-	}
 	return nil
 }
 
-// Setup notfound chain.
-func (gw *Gateway) newNotFound(data []NewHandlerData) error {
-	if len(data) == 0 {
-		return errors.New(`"notfound" must define handler`)
+// Return virtual host by url query "host",or default host.
+func (gw *Gateway) apiHost(c *router.Context) *virtualHost {
+	name := c.Req.URL.Query().Get("host")
+	if name == "" {
+		return gw.host
 	}
-	for _, h := range gw.notfound {
-		h.Release()
-	}
-	gw.notfound = make([]handler.Handler, 0)
-	for i, a := range data {
-		hd, err := handler.NewHandler(a.Name, a.Data)
-		if err != nil {
-			return fmt.Errorf(`"notfound[%d]" %s`, i, err.Error())
-		}
-		gw.notfound = append(gw.notfound, hd)
+	gw.hostLock.Lock()
+	h := gw.hosts[strings.ToLower(name)]
+	gw.hostLock.Unlock()
+	if h == nil {
+		c.WriteJSON(http.StatusNotFound, map[string]string{
+			"error": fmt.Sprintf("host %s not found", name),
+		})
 	}
-	return nil
+	return h
 }
 
 // Api management serve.
@@ -281,11 +280,14 @@ func (gw *Gateway) ApiServe() error {
 	rr.AddPut("/api/intercepts", gw.ApiPutIntercept)
 	rr.AddPut("/api/notfounds", gw.ApiPutNotFound)
 	rr.AddPut("/api/forwards", gw.ApiPutForward)
+	rr.AddPut("/api/hosts", gw.ApiPutHost)
+	rr.AddPut("/api/transports", gw.ApiPutTransport)
 	rr.AddPut("/api/token", gw.ApiPutToken)
+	rr.AddGet("/api/upstreams", gw.ApiGetUpstream)
 	// Start serve
-	gw.server.Handler = &rr
+	gw.apiServer.Handler = &rr
 	// Start serve
-	return gw.server.Serve(gw.listener)
+	return gw.apiServer.Serve(gw.apiListener)
 }
 
 // Put new intercept chain.
@@ -294,7 +296,11 @@ func (gw *Gateway) ApiPutIntercept(c *router.Context) bool {
 	if !readJSON(c, &data) {
 		return false
 	}
-	err := gw.newIntercept(data)
+	host := gw.apiHost(c)
+	if host == nil {
+		return false
+	}
+	err := host.newIntercept(data)
 	if err != nil {
 		c.WriteJSON(http.StatusBadRequest, map[string]string{
 			"error": err.Error(),
@@ -310,7 +316,11 @@ func (gw *Gateway) ApiPutNotFound(c *router.Context) bool {
 	if !readJSON(c, &data) {
 		return false
 	}
-	err := gw.newNotFound(data)
+	host := gw.apiHost(c)
+	if host == nil {
+		return false
+	}
+	err := host.newNotFound(data)
 	if err != nil {
 		c.WriteJSON(http.StatusBadRequest, map[string]string{
 			"error": err.Error(),
@@ -322,12 +332,50 @@ func (gw *Gateway) ApiPutNotFound(c *router.Context) bool {
 
 // Put new forward chain.
 func (gw *Gateway) ApiPutForward(c *router.Context) bool {
-	data := make(map[string][]NewHandlerData)
+	data := make(map[string]*NewForwardData)
+	if !readJSON(c, &data) {
+		return false
+	}
+	host := gw.apiHost(c)
+	if host == nil {
+		return false
+	}
+	for k, v := range data {
+		err := host.newForward(k, v)
+		if err != nil {
+			c.WriteJSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// Put new virtual hosts.
+func (gw *Gateway) ApiPutHost(c *router.Context) bool {
+	data := make(map[string]*NewHostData)
+	if !readJSON(c, &data) {
+		return false
+	}
+	err := gw.newHost(data)
+	if err != nil {
+		c.WriteJSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// Put new shared transports.
+func (gw *Gateway) ApiPutTransport(c *router.Context) bool {
+	data := make(map[string]*handler.TransportData)
 	if !readJSON(c, &data) {
 		return false
 	}
 	for k, v := range data {
-		err := gw.newForward(k, v)
+		err := handler.SetTransport(k, v)
 		if err != nil {
 			c.WriteJSON(http.StatusBadRequest, map[string]string{
 				"error": err.Error(),
@@ -338,6 +386,16 @@ func (gw *Gateway) ApiPutForward(c *router.Context) bool {
 	return true
 }
 
+// Get upstream status of forward routes.
+func (gw *Gateway) ApiGetUpstream(c *router.Context) bool {
+	host := gw.apiHost(c)
+	if host == nil {
+		return false
+	}
+	c.WriteJSON(http.StatusOK, host.UpstreamStatus())
+	return true
+}
+
 // Put new token.
 func (gw *Gateway) ApiPutToken(c *router.Context) bool {
 	data := make(map[string]interface{})
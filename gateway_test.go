@@ -30,20 +30,26 @@ func Test_NewGateway(t *testing.T) {
 				},
 			},
 		},
-		Forward: map[string][]NewHandlerData{
+		Forward: map[string]*NewForwardData{
 			"service1": {
-				{
-					Name: handler.DefaultForwarderName(),
-					Data: &handler.NewDefaultForwarderData{
-						RequestUrl: "http://127.0.0.1:3391",
+				Handler: []NewHandlerData{
+					{
+						Name: handler.DefaultForwarderName(),
+						Data: &handler.NewDefaultForwarderData{
+							RequestUrl: "http://127.0.0.1:3391",
+						},
 					},
 				},
 			},
 			"service2": {
-				{
-					Name: handler.DefaultForwarderName(),
-					Data: &handler.NewDefaultForwarderData{
-						RequestUrl: "http://127.0.0.1:3391",
+				Path:  "/service2/:id",
+				Match: "param",
+				Handler: []NewHandlerData{
+					{
+						Name: handler.DefaultForwarderName(),
+						Data: &handler.NewDefaultForwarderData{
+							RequestUrl: "http://127.0.0.1:3391",
+						},
 					},
 				},
 			},
@@ -5,4 +5,5 @@ go 1.15
 require (
 	github.com/qq51529210/http-router v0.0.0-20210529113305-f502ca79aef8
 	github.com/qq51529210/redis v0.0.0-20210526054006-bc3647eaa041
+	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
 )
@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qq51529210/redis"
+)
+
+var (
+	// APIKeyInterceptor register name.
+	apiKeyInterceptorRegisterName = HandlerName(&APIKeyInterceptor{})
+)
+
+func init() {
+	// Register APIKeyInterceptor.
+	RegisterHandler(apiKeyInterceptorRegisterName, NewAPIKeyInterceptor)
+}
+
+// Get APIKeyInterceptor register name.
+func APIKeyInterceptorRegisterName() string {
+	return apiKeyInterceptorRegisterName
+}
+
+// A API key record.
+type APIKeyData struct {
+	// Owner of key,it's "sub" of Identity.
+	Owner string `json:"owner"`
+	// Roles of owner.
+	Roles []string `json:"roles"`
+	// Scopes of key.
+	Scopes []string `json:"scopes"`
+	// Allowed route names,empty means all routes.
+	Route []string `json:"route"`
+	// Allowed request methods,empty means all methods.
+	Method []string `json:"method"`
+	// Requests per period,0 means no limit.
+	Limit int `json:"limit"`
+	// Rate limit period,millisecond,default is 1000.
+	Period int `json:"period"`
+}
+
+// Return true if route and method are allowed.
+func (d *APIKeyData) Allow(route, method string) bool {
+	return apiKeyAllow(d.Route, route, false) && apiKeyAllow(d.Method, method, true)
+}
+
+func apiKeyAllow(a []string, s string, fold bool) bool {
+	if len(a) < 1 {
+		return true
+	}
+	for _, v := range a {
+		if v == s || (fold && strings.EqualFold(v, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// API key store.
+type apiKeyStore interface {
+	// Return nil if key is not found.
+	Get(key string) (*APIKeyData, error)
+	Release()
+}
+
+// Keys from configure or file.
+type staticAPIKeyStore map[string]*APIKeyData
+
+func (s staticAPIKeyStore) Get(key string) (*APIKeyData, error) {
+	return s[key], nil
+}
+
+func (s staticAPIKeyStore) Release() {}
+
+// Keys in redis hash,field is key,value is json of APIKeyData.
+type redisAPIKeyStore struct {
+	redis *redis.Client
+	hash  string
+}
+
+func (s *redisAPIKeyStore) Get(key string) (*APIKeyData, error) {
+	value, err := s.redis.Cmd("HGET", s.hash, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("invalid redis reply type %s", reflect.TypeOf(value))
+	}
+	d := new(APIKeyData)
+	err = json.Unmarshal(data, d)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *redisAPIKeyStore) Release() {
+	s.redis.Close()
+}
+
+// A Interceptor that authenticate request by API key.
+// Key owner is saved in Context.Data as *Identity.
+type APIKeyInterceptor struct {
+	// Response of missing or unknown key,default status code is 401.
+	InterceptData
+	// Response of route or method not allowed,default status code is 403.
+	ForbiddenResponse InterceptData
+	// Response of rate limit,default status code is 429.
+	RateLimitResponse InterceptData
+	// Key header name.
+	Header string
+	// Key query parameter name.
+	Query string
+	// Use basic auth user as key.
+	BasicAuth bool
+	// Identity claims forward to upstream,key is claim name,value is header name.
+	ClaimHeader map[string]string
+	// Key store.
+	store apiKeyStore
+	// Per key rate limiters.
+	limiter apiKeyLimiter
+}
+
+func (h *APIKeyInterceptor) Release() {
+	if h.store != nil {
+		h.store.Release()
+	}
+}
+
+func (h *APIKeyInterceptor) Handle(c *Context) bool {
+	removeIdentityHeader(c.Req.Header, h.ClaimHeader)
+	key := h.key(c)
+	if key == "" {
+		h.InterceptData.WriteToResponse(c.Res)
+		return false
+	}
+	d, err := h.store.Get(key)
+	if err != nil {
+		logError(err)
+		h.InterceptData.WriteToResponse(c.Res)
+		return false
+	}
+	if d == nil {
+		h.InterceptData.WriteToResponse(c.Res)
+		return false
+	}
+	if !d.Allow(c.Route, c.Req.Method) {
+		h.ForbiddenResponse.WriteToResponse(c.Res)
+		return false
+	}
+	// Rate plan.
+	if d.Limit > 0 {
+		r := h.limiter.Take(key, d, time.Now())
+		header := c.Res.Header()
+		header.Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(r.remaining))
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(durationSeconds(r.reset), 10))
+		if !r.allowed {
+			header.Set("Retry-After", strconv.FormatInt(durationSeconds(r.retryAfter), 10))
+			h.RateLimitResponse.WriteToResponse(c.Res)
+			return false
+		}
+	}
+	id := NewIdentity(map[string]interface{}{
+		"sub":   d.Owner,
+		"roles": d.Roles,
+		"scp":   d.Scopes,
+	})
+	id.SetHeader(c.Req.Header, h.ClaimHeader)
+	c.Data = id
+	return true
+}
+
+// Return key from header,query or basic auth.
+func (h *APIKeyInterceptor) key(c *Context) string {
+	if h.Header != "" {
+		if s := c.Req.Header.Get(h.Header); s != "" {
+			return s
+		}
+	}
+	if h.Query != "" {
+		if s := c.Req.URL.Query().Get(h.Query); s != "" {
+			return s
+		}
+	}
+	if h.BasicAuth {
+		if s, _, ok := c.Req.BasicAuth(); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// Per key local token buckets.
+type apiKeyLimiter struct {
+	sync.Mutex
+	bucket map[string]*apiKeyBucket
+}
+
+type apiKeyBucket struct {
+	*localTokenBucket
+	// Last time used.
+	last time.Time
+}
+
+func (l *apiKeyLimiter) Take(key string, d *APIKeyData, now time.Time) *rateLimitResult {
+	period := time.Duration(d.Period) * time.Millisecond
+	if period < 1 {
+		period = time.Second
+	}
+	l.Lock()
+	if l.bucket == nil {
+		l.bucket = make(map[string]*apiKeyBucket)
+	}
+	b, ok := l.bucket[key]
+	// New key or plan changed.
+	if !ok || b.limit != d.Limit || b.period != period {
+		b = &apiKeyBucket{localTokenBucket: newLocalTokenBucket(d.Limit, period, d.Limit)}
+		l.bucket[key] = b
+	}
+	b.last = now
+	// Remove idle keys.
+	if len(l.bucket) > 1024 {
+		for k, v := range l.bucket {
+			if now.Sub(v.last) > v.fillTime()+v.period {
+				delete(l.bucket, k)
+			}
+		}
+	}
+	l.Unlock()
+	r, _ := b.Take("", now)
+	return r
+}
+
+type APIKeyInterceptorData struct {
+	InterceptData
+	// Response of route or method not allowed.
+	ForbiddenResponse InterceptData `json:"forbiddenResponse"`
+	// Response of rate limit.
+	RateLimitResponse InterceptData `json:"rateLimitResponse"`
+	// Key header name,default is "X-API-Key".
+	Header string `json:"header"`
+	// Key query parameter name,empty means don't use query.
+	Query string `json:"query"`
+	// Use basic auth user as key.
+	BasicAuth bool `json:"basicAuth"`
+	// Static keys,key is API key.
+	Key map[string]*APIKeyData `json:"key"`
+	// Json file of keys,same format as "key".
+	File string `json:"file"`
+	// Use redis hash to store keys,field is key,value is json of APIKeyData.
+	Redis *redis.ClientConfig `json:"redis"`
+	// Redis hash name,default is "gateway:apikey".
+	RedisHash string `json:"redisHash"`
+	// Identity claims forward to upstream,key is claim name,value is header name,
+	// like {"sub": "X-API-Key-Owner"}.
+	ClaimHeader map[string]string `json:"claimHeader"`
+}
+
+func (h *APIKeyInterceptor) Update(data interface{}) error {
+	d, ok := data.(*APIKeyInterceptorData)
+	if !ok {
+		return errors.New(`data must be "*APIKeyInterceptorData" type`)
+	}
+	// store
+	var store apiKeyStore
+	switch {
+	case d.Redis != nil:
+		hash := d.RedisHash
+		if hash == "" {
+			hash = "gateway:apikey"
+		}
+		store = &redisAPIKeyStore{redis: redis.NewClient(nil, d.Redis), hash: hash}
+	case d.File != "":
+		data, err := ioutil.ReadFile(d.File)
+		if err != nil {
+			return err
+		}
+		keys := make(staticAPIKeyStore)
+		err = json.Unmarshal(data, &keys)
+		if err != nil {
+			return fmt.Errorf(`"file" %s`, err.Error())
+		}
+		store = keys
+	case d.Key != nil:
+		store = staticAPIKeyStore(d.Key)
+	default:
+		return errors.New(`"key","file" or "redis" must be defined`)
+	}
+	if h.store != nil {
+		h.store.Release()
+	}
+	h.store = store
+	h.InterceptData = d.InterceptData
+	h.InterceptData.Check(http.StatusUnauthorized)
+	h.ForbiddenResponse = d.ForbiddenResponse
+	h.ForbiddenResponse.Check(http.StatusForbidden)
+	h.RateLimitResponse = d.RateLimitResponse
+	h.RateLimitResponse.Check(http.StatusTooManyRequests)
+	h.Header = d.Header
+	if h.Header == "" {
+		h.Header = "X-API-Key"
+	}
+	h.Query = d.Query
+	h.BasicAuth = d.BasicAuth
+	h.ClaimHeader = d.ClaimHeader
+	return nil
+}
+
+// Create a new APIKeyInterceptor
+func NewAPIKeyInterceptor(data interface{}) (Handler, error) {
+	var d *APIKeyInterceptorData
+	switch v := data.(type) {
+	case *APIKeyInterceptorData:
+		d = v
+	case string:
+		d = new(APIKeyInterceptorData)
+		err := json.Unmarshal([]byte(v), d)
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		d = new(APIKeyInterceptorData)
+		err := Map2Struct(v, d)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
+	}
+	h := new(APIKeyInterceptor)
+	err := h.Update(d)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/qq51529210/redis"
+)
+
+func Test_APIKeyInterceptor(t *testing.T) {
+	h, err := NewHandler(APIKeyInterceptorRegisterName(), &APIKeyInterceptorData{
+		Query:     "api_key",
+		BasicAuth: true,
+		Key: map[string]*APIKeyData{
+			"key1": {Owner: "partner1", Roles: []string{"partner"}, Route: []string{"orders"}, Method: []string{"get"}},
+			"key2": {Owner: "partner2", Limit: 2, Period: 60000},
+		},
+		ClaimHeader: map[string]string{"sub": "X-API-Key-Owner", "roles": "X-API-Key-Roles"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	// Header.
+	c, res := testHandle(h, "orders", testRequest(http.MethodGet, "http://127.0.0.1/", http.Header{"X-Api-Key": {"key1"}}))
+	if res.statusCode != 0 || c.Identity().Subject != "partner1" ||
+		c.Req.Header.Get("X-API-Key-Owner") != "partner1" || c.Req.Header.Get("X-API-Key-Roles") != "partner" {
+		t.FailNow()
+	}
+	// Query.
+	_, res = testHandle(h, "orders", testRequest(http.MethodGet, "http://127.0.0.1/?api_key=key1", nil))
+	if res.statusCode != 0 {
+		t.FailNow()
+	}
+	// Basic auth.
+	req := testRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	req.SetBasicAuth("key1", "")
+	_, res = testHandle(h, "orders", req)
+	if res.statusCode != 0 {
+		t.FailNow()
+	}
+	// Route and method not allowed.
+	_, res = testHandle(h, "users", testRequest(http.MethodGet, "http://127.0.0.1/", http.Header{"X-Api-Key": {"key1"}}))
+	if res.statusCode != http.StatusForbidden {
+		t.FailNow()
+	}
+	_, res = testHandle(h, "orders", testRequest(http.MethodPost, "http://127.0.0.1/", http.Header{"X-Api-Key": {"key1"}}))
+	if res.statusCode != http.StatusForbidden {
+		t.FailNow()
+	}
+	// Unknown or missing key,fake header removed.
+	c, res = testHandle(h, "orders", testRequest(http.MethodGet, "http://127.0.0.1/", http.Header{"X-Api-Key": {"key3"}, "X-Api-Key-Owner": {"fake"}}))
+	if res.statusCode != http.StatusUnauthorized || c.Identity() != nil || c.Req.Header.Get("X-API-Key-Owner") != "" {
+		t.FailNow()
+	}
+	_, res = testHandle(h, "orders", testRequest(http.MethodGet, "http://127.0.0.1/", nil))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	// Rate plan.
+	for i := 0; i < 2; i++ {
+		_, res = testHandle(h, "users", testRequest(http.MethodPost, "http://127.0.0.1/", http.Header{"X-Api-Key": {"key2"}}))
+		if res.statusCode != 0 {
+			t.FailNow()
+		}
+	}
+	_, res = testHandle(h, "users", testRequest(http.MethodPost, "http://127.0.0.1/", http.Header{"X-Api-Key": {"key2"}}))
+	if res.statusCode != http.StatusTooManyRequests || res.Header().Get("Retry-After") == "" {
+		t.FailNow()
+	}
+}
+
+func Test_APIKeyInterceptorFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "apikey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"key1": {"owner": "partner1"}}`)
+	f.Close()
+	h, err := NewHandler(APIKeyInterceptorRegisterName(), map[string]interface{}{
+		"header": "X-Key",
+		"file":   f.Name(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	c, res := testHandle(h, "", testRequest(http.MethodGet, "http://127.0.0.1/", http.Header{"X-Key": {"key1"}}))
+	if res.statusCode != 0 || c.Identity().Subject != "partner1" {
+		t.FailNow()
+	}
+	_, err = NewHandler(APIKeyInterceptorRegisterName(), &APIKeyInterceptorData{})
+	if err == nil {
+		t.FailNow()
+	}
+}
+
+func Test_APIKeyInterceptorRedis(t *testing.T) {
+	h, err := NewHandler(APIKeyInterceptorRegisterName(), &APIKeyInterceptorData{
+		Redis:     &redis.ClientConfig{},
+		RedisHash: "test:apikey",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	store := h.(*APIKeyInterceptor).store.(*redisAPIKeyStore)
+	store.redis.Cmd("hdel", store.hash, "key1", "key2")
+	store.redis.Cmd("hset", store.hash, "key1", `{"owner":"partner1","route":["orders"]}`)
+	// Malformed record.
+	store.redis.Cmd("hset", store.hash, "key2", `{"owner":"x","route":"admin","method":["GET"]}`)
+	c, res := testHandle(h, "orders", testRequest(http.MethodGet, "http://127.0.0.1/", http.Header{"X-Api-Key": {"key1"}}))
+	if res.statusCode != 0 || c.Identity().Subject != "partner1" {
+		t.FailNow()
+	}
+	_, res = testHandle(h, "admin", testRequest(http.MethodGet, "http://127.0.0.1/", http.Header{"X-Api-Key": {"key2"}}))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	_, res = testHandle(h, "orders", testRequest(http.MethodGet, "http://127.0.0.1/", http.Header{"X-Api-Key": {"key3"}}))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+}
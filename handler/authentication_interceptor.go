@@ -28,10 +28,13 @@ func AuthenticationInterceptorRegisterName() string {
 
 // A Interceptor that handle authentication.
 // It'll check cookie and header["Authorization"].
+// Token value in redis is saved in Context.Data as *Identity.
 type AuthenticationInterceptor struct {
 	InterceptData
 	// Cookie name.
 	CookieName string
+	// Claims forward to upstream,key is claim name,value is header name.
+	ClaimHeader map[string]string
 	// Redis client
 	redis *redis.Client
 }
@@ -43,6 +46,21 @@ func (h *AuthenticationInterceptor) Release() {
 }
 
 func (h *AuthenticationInterceptor) Handle(c *Context) bool {
+	value := h.lookup(c)
+	if value == nil {
+		// Token not found.
+		removeIdentityHeader(c.Req.Header, h.ClaimHeader)
+		h.InterceptData.WriteToResponse(c.Res)
+		return false
+	}
+	id := newTokenIdentity(value)
+	id.SetHeader(c.Req.Header, h.ClaimHeader)
+	c.Data = id
+	return true
+}
+
+// Return value of token in redis,or nil if not found.
+func (h *AuthenticationInterceptor) lookup(c *Context) interface{} {
 	// 1. Cookie
 	if h.CookieName != "" {
 		cookie, _ := c.Req.Cookie(h.CookieName)
@@ -50,7 +68,7 @@ func (h *AuthenticationInterceptor) Handle(c *Context) bool {
 		if cookie != nil {
 			value, err := h.redis.Cmd("GET", cookie.Value)
 			if err == nil && value != nil {
-				return true
+				return value
 			}
 		}
 	}
@@ -61,13 +79,31 @@ func (h *AuthenticationInterceptor) Handle(c *Context) bool {
 		if strings.HasPrefix(str, bearerTokenPrefix) {
 			value, err := h.redis.Cmd("GET", str[len(bearerTokenPrefix):])
 			if err == nil && value != nil {
-				return true
+				return value
 			}
 		}
 	}
-	// 3. Token not found.
-	h.InterceptData.WriteToResponse(c.Res)
-	return false
+	return nil
+}
+
+// Create Identity from token value in redis.
+// If value is a json object,it's claims,else it's "sub".
+func newTokenIdentity(value interface{}) *Identity {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return NewIdentity(map[string]interface{}{"sub": claimString(v)})
+	}
+	var claims map[string]interface{}
+	err := json.Unmarshal(data, &claims)
+	if err != nil || claims == nil {
+		return NewIdentity(map[string]interface{}{"sub": string(data)})
+	}
+	return NewIdentity(claims)
 }
 
 func (h *AuthenticationInterceptor) Update(data interface{}) error {
@@ -88,6 +124,7 @@ func (h *AuthenticationInterceptor) Update(data interface{}) error {
 	} else {
 		h.CookieName = d.CookieName
 	}
+	h.ClaimHeader = d.ClaimHeader
 	return nil
 }
 
@@ -95,6 +132,9 @@ type AuthenticationInterceptorData struct {
 	InterceptData
 	Redis      *redis.ClientConfig `json:"redis"`
 	CookieName string              `json:"cookieName"`
+	// Claims of token value forward to upstream,key is claim name,value is header name,
+	// like {"id": "X-User-Id","roles": "X-User-Roles"}.
+	ClaimHeader map[string]string `json:"claimHeader"`
 }
 
 // Create a new AuthenticationInterceptor
@@ -110,6 +150,7 @@ func NewAuthenticationInterceptor(data interface{}) (Handler, error) {
 			return nil, err
 		}
 	case map[string]interface{}:
+		d = new(AuthenticationInterceptorData)
 		err := Map2Struct(v, d)
 		if err != nil {
 			return nil, err
@@ -31,6 +31,9 @@ func Test_AuthenticationInterceptor(t *testing.T) {
 	if !h.Handle(&c) || res.statusCode == data.StatusCode || res.Header().Get("Content-Type") == data.ContentType || res.body.String() == data.Message {
 		t.FailNow()
 	}
+	if c.Identity() == nil || c.Identity().Subject != "1" {
+		t.FailNow()
+	}
 
 	c.Req.Header = make(http.Header)
 	c.Req.AddCookie(&http.Cookie{Name: data.CookieName, Value: token})
@@ -47,3 +50,31 @@ func Test_AuthenticationInterceptor(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func Test_NewTokenIdentity(t *testing.T) {
+	id := newTokenIdentity([]byte(`{"sub":"1001","id":1001,"roles":["admin","user"]}`))
+	header := make(http.Header)
+	header.Set("X-User-Roles", "fake")
+	header.Set("X-User-Name", "fake")
+	id.SetHeader(header, map[string]string{"id": "X-User-Id", "roles": "X-User-Roles", "name": "X-User-Name"})
+	if id.Subject != "1001" || len(id.Roles) != 2 ||
+		header.Get("X-User-Id") != "1001" || header.Get("X-User-Roles") != "admin,user" || header.Get("X-User-Name") != "" {
+		t.Fatal(header)
+	}
+	// Not json object.
+	id = newTokenIdentity("1002")
+	if id.Subject != "1002" {
+		t.FailNow()
+	}
+	id = newTokenIdentity(int64(1003))
+	if id.Subject != "1003" {
+		t.FailNow()
+	}
+	// Number claims.
+	id = newTokenIdentity(`{"sub":1000000,"id":1.5,"admin":true}`)
+	header = make(http.Header)
+	id.SetHeader(header, map[string]string{"id": "X-User-Id", "admin": "X-User-Admin"})
+	if id.Subject != "1000000" || header.Get("X-User-Id") != "1.5" || header.Get("X-User-Admin") != "true" {
+		t.Fatal(id.Subject, header)
+	}
+}
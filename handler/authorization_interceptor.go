@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// AuthorizationInterceptor register name.
+	authorizationInterceptorRegisterName = HandlerName(&AuthorizationInterceptor{})
+)
+
+func init() {
+	// Register AuthorizationInterceptor.
+	RegisterHandler(authorizationInterceptorRegisterName, NewAuthorizationInterceptor)
+}
+
+// Get AuthorizationInterceptor register name.
+func AuthorizationInterceptorRegisterName() string {
+	return authorizationInterceptorRegisterName
+}
+
+const (
+	AuthorizationAllow = "allow"
+	AuthorizationDeny  = "deny"
+)
+
+// A Interceptor that authorizes request by rules,use it after authentication handlers.
+// Identity is Context.Data saved by authentication handlers.
+// Matched deny rule wins,then matched allow rule,then default policy.
+type AuthorizationInterceptor struct {
+	// Value is *authorizationPolicy,replaced by Update.
+	policy atomic.Value
+}
+
+// Compiled AuthorizationInterceptorData.
+type authorizationPolicy struct {
+	InterceptData
+	rules []*authorizationRule
+	// Allow request if no rule matches it.
+	defaultAllow bool
+}
+
+// Compiled AuthorizationRuleData.
+type authorizationRule struct {
+	deny   bool
+	route  map[string]int
+	path   []string
+	method map[string]int
+	role   []string
+	scope  []string
+	claim  map[string][]string
+}
+
+func (h *AuthorizationInterceptor) Release() {
+}
+
+func (h *AuthorizationInterceptor) Handle(c *Context) bool {
+	p := h.policy.Load().(*authorizationPolicy)
+	if p.Authorize(c.Route, c.Req, c.Identity()) {
+		return true
+	}
+	p.InterceptData.WriteToResponse(c.Res)
+	return false
+}
+
+// Return true if identity(can be nil) can access request of route.
+func (p *authorizationPolicy) Authorize(route string, req *http.Request, id *Identity) bool {
+	// Match cleaned path,so "//admin" or "/a/../admin" can't bypass "/admin/**".
+	urlPath := path.Clean("/" + req.URL.Path)
+	// Some allow rule matches request.
+	matched := false
+	allow := false
+	for _, r := range p.rules {
+		if !r.MatchRequest(route, req.Method, urlPath) {
+			continue
+		}
+		if !r.deny {
+			matched = true
+		}
+		if !r.MatchIdentity(id) {
+			continue
+		}
+		if r.deny {
+			return false
+		}
+		allow = true
+	}
+	if matched {
+		return allow
+	}
+	return p.defaultAllow
+}
+
+// Return true if route,path and method match.
+func (r *authorizationRule) MatchRequest(route, method, urlPath string) bool {
+	if r.route != nil {
+		if _, ok := r.route[route]; !ok {
+			return false
+		}
+	}
+	if r.method != nil {
+		if _, ok := r.method[method]; !ok {
+			return false
+		}
+	}
+	if r.path == nil {
+		return true
+	}
+	for _, s := range r.path {
+		if authorizationMatchPath(s, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return true if identity has any of roles,all of scopes and all of claims.
+// Rule without conditions matches any request,including anonymous.
+func (r *authorizationRule) MatchIdentity(id *Identity) bool {
+	if len(r.role) < 1 && len(r.scope) < 1 && len(r.claim) < 1 {
+		return true
+	}
+	if id == nil {
+		return false
+	}
+	if len(r.role) > 0 && !authorizationContainsAny(id.Roles, r.role) {
+		return false
+	}
+	for _, s := range r.scope {
+		if !authorizationContainsAny(id.Scopes, []string{s}) {
+			return false
+		}
+	}
+	for k, v := range r.claim {
+		if !authorizationContainsAny(claimStrings(id.Claims[k]), v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Pattern is path.Match pattern,"/**" suffix matches all sub paths.
+func authorizationMatchPath(pattern, s string) bool {
+	if strings.HasSuffix(pattern, "/**") {
+		prefix := pattern[:len(pattern)-3]
+		return s == prefix || strings.HasPrefix(s, prefix+"/")
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+func authorizationContainsAny(a, b []string) bool {
+	for _, s := range a {
+		for _, v := range b {
+			if s == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type AuthorizationRuleData struct {
+	// "allow" or "deny",default is "allow".
+	Effect string `json:"effect"`
+	// Route names,empty means all routes.
+	Route []string `json:"route"`
+	// Request path patterns,like "/users/*" or "/admin/**",empty means all paths.
+	Path []string `json:"path"`
+	// Request methods,empty means all methods.
+	Method []string `json:"method"`
+	// Identity has any of roles.
+	Role []string `json:"role"`
+	// Identity has all of scopes.
+	Scope []string `json:"scope"`
+	// Identity claim has any of values,for all claims.
+	Claim map[string][]string `json:"claim"`
+}
+
+type AuthorizationInterceptorData struct {
+	// Response of denied request,default status code is 403.
+	InterceptData
+	// Rules.
+	Rule []*AuthorizationRuleData `json:"rule"`
+	// Policy when no rule matches,"allow" or "deny",default is "deny".
+	DefaultPolicy string `json:"defaultPolicy"`
+}
+
+// Update AuthorizationInterceptor,data is *AuthorizationInterceptorData.
+// It's safe to update while handling requests.
+func (h *AuthorizationInterceptor) Update(data interface{}) error {
+	d, ok := data.(*AuthorizationInterceptorData)
+	if !ok {
+		return errors.New(`data must be "*AuthorizationInterceptorData" type`)
+	}
+	p := new(authorizationPolicy)
+	switch d.DefaultPolicy {
+	case AuthorizationAllow:
+		p.defaultAllow = true
+	case AuthorizationDeny, "":
+	default:
+		return fmt.Errorf(`invalid default policy "%s"`, d.DefaultPolicy)
+	}
+	for i, rd := range d.Rule {
+		if rd == nil {
+			return fmt.Errorf("rule %d is nil", i)
+		}
+		r := new(authorizationRule)
+		switch rd.Effect {
+		case AuthorizationDeny:
+			r.deny = true
+		case AuthorizationAllow, "":
+		default:
+			return fmt.Errorf(`rule %d invalid effect "%s"`, i, rd.Effect)
+		}
+		if len(rd.Route) > 0 {
+			r.route = make(map[string]int)
+			for _, s := range rd.Route {
+				r.route[s] = 1
+			}
+		}
+		if len(rd.Method) > 0 {
+			r.method = make(map[string]int)
+			for _, s := range rd.Method {
+				r.method[strings.ToUpper(s)] = 1
+			}
+		}
+		for _, s := range rd.Path {
+			_, err := path.Match(strings.TrimSuffix(s, "/**"), "")
+			if err != nil {
+				return fmt.Errorf(`rule %d path "%s" %s`, i, s, err.Error())
+			}
+			r.path = append(r.path, s)
+		}
+		r.role = rd.Role
+		r.scope = rd.Scope
+		r.claim = rd.Claim
+		p.rules = append(p.rules, r)
+	}
+	p.InterceptData = d.InterceptData
+	p.InterceptData.Check(http.StatusForbidden)
+	h.policy.Store(p)
+	return nil
+}
+
+// Create a new AuthorizationInterceptor
+func NewAuthorizationInterceptor(data interface{}) (Handler, error) {
+	var d *AuthorizationInterceptorData
+	switch v := data.(type) {
+	case *AuthorizationInterceptorData:
+		d = v
+	case string:
+		d = new(AuthorizationInterceptorData)
+		err := json.Unmarshal([]byte(v), d)
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		d = new(AuthorizationInterceptorData)
+		err := Map2Struct(v, d)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
+	}
+	h := new(AuthorizationInterceptor)
+	err := h.Update(d)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func Test_AuthorizationInterceptor(t *testing.T) {
+	h, err := NewAuthorizationInterceptor(`{
+		"message": "forbidden",
+		"rule": [
+			{"path": ["/public/**"]},
+			{"route": ["orders"], "method": ["get"], "scope": ["orders:read"]},
+			{"route": ["orders"], "method": ["POST", "DELETE"], "role": ["admin", "writer"]},
+			{"effect": "deny", "route": ["orders"], "claim": {"status": ["locked"]}},
+			{"path": ["/users/*"], "claim": {"tenant": ["a", "b", "1000000"]}}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	call := func(route, method, url string, claims map[string]interface{}) int {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c Context
+		res := new(testResponse)
+		c.Reset(res, req)
+		c.Route = route
+		if claims != nil {
+			c.Data = NewIdentity(claims)
+		}
+		if h.Handle(&c) {
+			return http.StatusOK
+		}
+		if res.body.String() != "forbidden" {
+			t.FailNow()
+		}
+		return res.statusCode
+	}
+	reader := map[string]interface{}{"sub": "1", "scope": "orders:read profile"}
+	writer := map[string]interface{}{"sub": "2", "roles": []interface{}{"writer"}}
+	locked := map[string]interface{}{"sub": "3", "roles": []interface{}{"admin"}, "status": "locked"}
+	for i, v := range []struct {
+		route, method, url string
+		claims             map[string]interface{}
+		code               int
+	}{
+		{"", http.MethodGet, "http://a/public/a/b", nil, http.StatusOK},
+		{"", http.MethodGet, "http://a/public", nil, http.StatusOK},
+		{"", http.MethodGet, "http://a/publicity", nil, http.StatusForbidden},
+		{"orders", http.MethodGet, "http://a/orders", reader, http.StatusOK},
+		{"orders", http.MethodGet, "http://a/orders", nil, http.StatusForbidden},
+		{"orders", http.MethodPost, "http://a/orders", reader, http.StatusForbidden},
+		{"orders", http.MethodPost, "http://a/orders", writer, http.StatusOK},
+		{"orders", http.MethodPut, "http://a/orders", writer, http.StatusForbidden},
+		{"orders", http.MethodDelete, "http://a/orders", locked, http.StatusForbidden},
+		{"", http.MethodGet, "http://a/users/1", map[string]interface{}{"tenant": "b"}, http.StatusOK},
+		{"", http.MethodGet, "http://a/users/1", map[string]interface{}{"tenant": "c"}, http.StatusForbidden},
+		{"", http.MethodGet, "http://a/users/1", map[string]interface{}{"tenant": float64(1000000)}, http.StatusOK},
+		{"", http.MethodGet, "http://a/users/1/x", map[string]interface{}{"tenant": "a"}, http.StatusForbidden},
+	} {
+		if code := call(v.route, v.method, v.url, v.claims); code != v.code {
+			t.Fatal(i, code)
+		}
+	}
+	// Update.
+	err = h.Update(&AuthorizationInterceptorData{
+		InterceptData: InterceptData{Message: "forbidden"},
+		Rule:          []*AuthorizationRuleData{{Effect: AuthorizationDeny, Path: []string{"/admin/**"}}},
+		DefaultPolicy: AuthorizationAllow,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call("", http.MethodGet, "http://a/admin/x", locked) != http.StatusForbidden ||
+		call("", http.MethodGet, "http://a//admin/a", nil) != http.StatusForbidden ||
+		call("", http.MethodGet, "http://a/public/../admin/a", nil) != http.StatusForbidden ||
+		call("", http.MethodGet, "http://a/admin/../public", nil) != http.StatusOK ||
+		call("", http.MethodGet, "http://a/publicity", nil) != http.StatusOK {
+		t.FailNow()
+	}
+	// Invalid.
+	if h.Update(&AuthorizationInterceptorData{Rule: []*AuthorizationRuleData{{Effect: "maybe"}}}) == nil ||
+		h.Update(&AuthorizationInterceptorData{Rule: []*AuthorizationRuleData{{Path: []string{"/a/["}}}}) == nil {
+		t.FailNow()
+	}
+}
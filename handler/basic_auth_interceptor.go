@@ -0,0 +1,538 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qq51529210/redis"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// BasicAuthInterceptor register name.
+	basicAuthInterceptorRegisterName = HandlerName(&BasicAuthInterceptor{})
+)
+
+func init() {
+	// Register BasicAuthInterceptor.
+	RegisterHandler(basicAuthInterceptorRegisterName, NewBasicAuthInterceptor)
+}
+
+// Get BasicAuthInterceptor register name.
+func BasicAuthInterceptorRegisterName() string {
+	return basicAuthInterceptorRegisterName
+}
+
+// Password store,return empty string if user is not found.
+type basicAuthStore interface {
+	Get(user string) (string, error)
+	Release()
+}
+
+// Users from configure or htpasswd file.
+type staticBasicAuthStore map[string]string
+
+func (s staticBasicAuthStore) Get(user string) (string, error) {
+	return s[user], nil
+}
+
+func (s staticBasicAuthStore) Release() {}
+
+// Users in redis hash,field is user,value is password.
+type redisBasicAuthStore struct {
+	redis *redis.Client
+	hash  string
+}
+
+func (s *redisBasicAuthStore) Get(user string) (string, error) {
+	value, err := s.redis.Cmd("HGET", s.hash, user)
+	if err != nil {
+		return "", err
+	}
+	return redisString(value)
+}
+
+func (s *redisBasicAuthStore) Release() {
+	s.redis.Close()
+}
+
+// A Interceptor that handle HTTP Basic and Digest authentication.
+// Failed request get 401 with challenges.
+// User is saved in Context.Data as *Identity.
+type BasicAuthInterceptor struct {
+	InterceptData
+	// Realm of challenge.
+	Realm string
+	// Accept Digest authentication.
+	Digest bool
+	// Claims forward to upstream,key is claim name,value is header name.
+	ClaimHeader map[string]string
+	// Password store.
+	store basicAuthStore
+	// Digest nonce secret.
+	nonceKey []byte
+	// Digest nonce lifetime.
+	nonceTTL time.Duration
+	// Last nonce count of Digest nonces.
+	nonceCount *digestNonceCount
+}
+
+func (h *BasicAuthInterceptor) Release() {
+	if h.store != nil {
+		h.store.Release()
+	}
+}
+
+func (h *BasicAuthInterceptor) Handle(c *Context) bool {
+	removeIdentityHeader(c.Req.Header, h.ClaimHeader)
+	user, err := h.authenticate(c.Req)
+	if err != nil {
+		logError(err)
+	}
+	if user == "" {
+		header := c.Res.Header()
+		header.Add("WWW-Authenticate", fmt.Sprintf(`Basic realm=%s, charset="UTF-8"`, strconv.Quote(h.Realm)))
+		if h.Digest {
+			header.Add("WWW-Authenticate", fmt.Sprintf(`Digest realm=%s, qop="auth", algorithm=MD5, nonce="%s"`,
+				strconv.Quote(h.Realm), h.newNonce(time.Now())))
+		}
+		h.InterceptData.WriteToResponse(c.Res)
+		return false
+	}
+	id := NewIdentity(map[string]interface{}{"sub": user})
+	id.SetHeader(c.Req.Header, h.ClaimHeader)
+	c.Data = id
+	return true
+}
+
+// Return authenticated user,or empty string.
+func (h *BasicAuthInterceptor) authenticate(req *http.Request) (string, error) {
+	str := req.Header.Get("Authorization")
+	if h.Digest && strings.HasPrefix(str, "Digest ") {
+		return h.authenticateDigest(req, str[len("Digest "):])
+	}
+	user, password, ok := req.BasicAuth()
+	if !ok || user == "" {
+		return "", nil
+	}
+	secret, err := h.store.Get(user)
+	if err != nil || secret == "" {
+		return "", err
+	}
+	ok, err = basicAuthVerify(secret, user, h.Realm, password)
+	if !ok {
+		return "", err
+	}
+	return user, nil
+}
+
+// Verify Digest authorization,qop must be "auth".
+// Nonce count must be greater than the last one of the nonce,so that authorization can't be replayed.
+func (h *BasicAuthInterceptor) authenticateDigest(req *http.Request, str string) (string, error) {
+	param := parseDigestParams(str)
+	user := param["username"]
+	nc, err := strconv.ParseUint(param["nc"], 16, 32)
+	if err != nil || user == "" || param["realm"] != h.Realm || param["qop"] != "auth" || param["uri"] != req.RequestURI ||
+		(param["algorithm"] != "" && param["algorithm"] != "MD5") || !h.checkNonce(param["nonce"], time.Now()) {
+		return "", nil
+	}
+	secret, err := h.store.Get(user)
+	if err != nil || secret == "" {
+		return "", err
+	}
+	ha1, err := basicAuthHA1(secret, user, h.Realm)
+	if err != nil {
+		return "", err
+	}
+	ha2 := md5Hex(req.Method + ":" + param["uri"])
+	response := md5Hex(strings.Join([]string{ha1, param["nonce"], param["nc"], param["cnonce"], param["qop"], ha2}, ":"))
+	if subtle.ConstantTimeCompare([]byte(response), []byte(param["response"])) != 1 ||
+		!h.nonceCount.Next(param["nonce"], nc, time.Now().Add(h.nonceTTL)) {
+		return "", nil
+	}
+	return user, nil
+}
+
+// Last nonce count of each Digest nonce.
+type digestNonceCount struct {
+	sync.Mutex
+	count map[string]*digestNonceCountEntry
+	// Last time remove expired nonce.
+	sweep time.Time
+}
+
+type digestNonceCountEntry struct {
+	nc     uint64
+	expire time.Time
+}
+
+func newDigestNonceCount() *digestNonceCount {
+	return &digestNonceCount{count: make(map[string]*digestNonceCountEntry), sweep: time.Now()}
+}
+
+// Return false if nc is not greater than the last one of nonce.
+// Record is kept until expire.
+func (c *digestNonceCount) Next(nonce string, nc uint64, expire time.Time) bool {
+	now := time.Now()
+	c.Lock()
+	defer c.Unlock()
+	if now.Sub(c.sweep) > time.Minute {
+		for k, v := range c.count {
+			if now.After(v.expire) {
+				delete(c.count, k)
+			}
+		}
+		c.sweep = now
+	}
+	e, ok := c.count[nonce]
+	if !ok {
+		c.count[nonce] = &digestNonceCountEntry{nc: nc, expire: expire}
+		return true
+	}
+	if nc <= e.nc {
+		return false
+	}
+	e.nc = nc
+	return true
+}
+
+// Create a stateless nonce,base64(time + random + hmac(time + random)).
+// Random bytes make every nonce unique,so nonce count can be tracked per nonce.
+func (h *BasicAuthInterceptor) newNonce(now time.Time) string {
+	var data [16 + sha256.Size]byte
+	binary.BigEndian.PutUint64(data[:8], uint64(now.Unix()))
+	rand.Read(data[8:16])
+	mac := hmac.New(sha256.New, h.nonceKey)
+	mac.Write(data[:16])
+	copy(data[16:], mac.Sum(nil))
+	return base64.RawURLEncoding.EncodeToString(data[:])
+}
+
+// Return true if nonce is created by newNonce and not expired.
+func (h *BasicAuthInterceptor) checkNonce(nonce string, now time.Time) bool {
+	data, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(data) != 16+sha256.Size {
+		return false
+	}
+	mac := hmac.New(sha256.New, h.nonceKey)
+	mac.Write(data[:16])
+	if !hmac.Equal(mac.Sum(nil), data[16:]) {
+		return false
+	}
+	created := time.Unix(int64(binary.BigEndian.Uint64(data[:8])), 0)
+	return now.Sub(created) < h.nonceTTL
+}
+
+// Parse `k1="v1", k2=v2`.
+func parseDigestParams(str string) map[string]string {
+	param := make(map[string]string)
+	for len(str) > 0 {
+		str = strings.TrimLeft(str, " ,")
+		i := strings.IndexByte(str, '=')
+		if i < 0 {
+			break
+		}
+		key := strings.TrimSpace(str[:i])
+		str = str[i+1:]
+		var value string
+		if strings.HasPrefix(str, `"`) {
+			var b strings.Builder
+			i = 1
+			for ; i < len(str) && str[i] != '"'; i++ {
+				if str[i] == '\\' && i+1 < len(str) {
+					i++
+				}
+				b.WriteByte(str[i])
+			}
+			value = b.String()
+			if i < len(str) {
+				i++
+			}
+			str = str[i:]
+		} else {
+			i = strings.IndexByte(str, ',')
+			if i < 0 {
+				i = len(str)
+			}
+			value = strings.TrimSpace(str[:i])
+			str = str[i:]
+		}
+		param[key] = value
+	}
+	return param
+}
+
+// Verify password with stored secret,which can be
+// "$2y$" bcrypt,"{SHA}" + base64(sha1),"$apr1$" MD5,"{HA1}" + htdigest hex or "{PLAIN}" + plain text.
+// Other formats are rejected,so that an unsupported hash can't be used as password.
+func basicAuthVerify(secret, user, realm, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(secret, "{PLAIN}"):
+		return subtle.ConstantTimeCompare([]byte(secret[len("{PLAIN}"):]), []byte(password)) == 1, nil
+	case strings.HasPrefix(secret, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(secret[len("{SHA}"):]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1, nil
+	case strings.HasPrefix(secret, "$apr1$"):
+		salt := secret[len("$apr1$"):]
+		if i := strings.IndexByte(salt, '$'); i >= 0 {
+			salt = salt[:i]
+		}
+		return subtle.ConstantTimeCompare([]byte(secret), []byte(apr1(password, salt))) == 1, nil
+	case strings.HasPrefix(secret, "{HA1}"):
+		return subtle.ConstantTimeCompare([]byte(secret[len("{HA1}"):]), []byte(md5Hex(user+":"+realm+":"+password))) == 1, nil
+	case strings.HasPrefix(secret, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(secret), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return false, fmt.Errorf(`password format of user "%s" is not supported`, user)
+	}
+}
+
+// Return HA1 of Digest,secret must be "{PLAIN}" or "{HA1}".
+func basicAuthHA1(secret, user, realm string) (string, error) {
+	switch {
+	case strings.HasPrefix(secret, "{HA1}"):
+		return secret[len("{HA1}"):], nil
+	case strings.HasPrefix(secret, "{PLAIN}"):
+		return md5Hex(user + ":" + realm + ":" + secret[len("{PLAIN}"):]), nil
+	default:
+		return "", fmt.Errorf(`password of user "%s" can't be used for Digest`, user)
+	}
+}
+
+// Return true if secret has a format prefix,otherwise it's plain text of configure.
+func basicAuthHasFormat(secret string) bool {
+	return strings.HasPrefix(secret, "$") || strings.HasPrefix(secret, "{SHA}") ||
+		strings.HasPrefix(secret, "{HA1}") || strings.HasPrefix(secret, "{PLAIN}")
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Apache "$apr1$" MD5 crypt.
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+	h := md5.New()
+	h.Write(pw)
+	h.Write([]byte(magic + salt))
+	alt := md5.Sum([]byte(password + salt + password))
+	for i := len(pw); i > 0; i -= 16 {
+		n := i
+		if n > 16 {
+			n = 16
+		}
+		h.Write(alt[:n])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	final := h.Sum(nil)
+	for i := 0; i < 1000; i++ {
+		h = md5.New()
+		if i&1 != 0 {
+			h.Write(pw)
+		} else {
+			h.Write(final)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 != 0 {
+			h.Write(final)
+		} else {
+			h.Write(pw)
+		}
+		final = h.Sum(nil)
+	}
+	var b strings.Builder
+	b.WriteString(magic + salt + "$")
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			b.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, i := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint(final[i[0]])<<16|uint(final[i[1]])<<8|uint(final[i[2]]), 4)
+	}
+	encode(uint(final[11]), 2)
+	return b.String()
+}
+
+// Load htpasswd file,"user:password" per line.
+func loadHtpasswd(name string) (staticBasicAuthStore, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	store := make(staticBasicAuthStore)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := bytes.TrimSpace(scanner.Bytes())
+		if len(s) < 1 || s[0] == '#' {
+			continue
+		}
+		i := bytes.IndexByte(s, ':')
+		if i < 1 {
+			return nil, fmt.Errorf(`"%s" line %d invalid format`, name, line)
+		}
+		store[string(s[:i])] = string(s[i+1:])
+	}
+	return store, scanner.Err()
+}
+
+type BasicAuthInterceptorData struct {
+	InterceptData
+	// Realm of challenge,default is "gateway".
+	Realm string `json:"realm"`
+	// Accept Digest authentication(MD5,qop "auth"),password must be plain text,"{PLAIN}" or "{HA1}".
+	Digest bool `json:"digest"`
+	// Digest nonce lifetime,millisecond,default is 300000.
+	NonceTTL int `json:"nonceTTL"`
+	// Digest nonce secret,gateways behind a load balancer should use the same one.
+	// Default is random.
+	NonceSecret string `json:"nonceSecret"`
+	// Users,key is user name,value is password.
+	// Password can be "$2y$" bcrypt,"{SHA}" + base64(sha1),"$apr1$" MD5,"{HA1}" + md5(user:realm:password) hex,
+	// "{PLAIN}" + plain text or plain text.
+	User map[string]string `json:"user"`
+	// Htpasswd file,password formats are same as "user",but plain text must be "{PLAIN}".
+	File string `json:"file"`
+	// Use redis hash to store users,field is user,value is password,same formats as "file".
+	Redis *redis.ClientConfig `json:"redis"`
+	// Redis hash name,default is "gateway:basicauth".
+	RedisHash string `json:"redisHash"`
+	// Claims forward to upstream,key is claim name,value is header name,
+	// like {"sub": "X-User-Id"}.
+	ClaimHeader map[string]string `json:"claimHeader"`
+}
+
+func (h *BasicAuthInterceptor) Update(data interface{}) error {
+	d, ok := data.(*BasicAuthInterceptorData)
+	if !ok {
+		return errors.New(`data must be "*BasicAuthInterceptorData" type`)
+	}
+	// store
+	var store basicAuthStore
+	switch {
+	case d.Redis != nil:
+		hash := d.RedisHash
+		if hash == "" {
+			hash = "gateway:basicauth"
+		}
+		store = &redisBasicAuthStore{redis: redis.NewClient(nil, d.Redis), hash: hash}
+	case d.File != "":
+		users, err := loadHtpasswd(d.File)
+		if err != nil {
+			return err
+		}
+		store = users
+	case d.User != nil:
+		// Only configure users can be plain text without "{PLAIN}".
+		users := make(staticBasicAuthStore)
+		for k, v := range d.User {
+			if !basicAuthHasFormat(v) {
+				v = "{PLAIN}" + v
+			}
+			users[k] = v
+		}
+		store = users
+	default:
+		return errors.New(`"user","file" or "redis" must be defined`)
+	}
+	if h.store != nil {
+		h.store.Release()
+	}
+	h.store = store
+	h.InterceptData = d.InterceptData
+	h.InterceptData.Check(http.StatusUnauthorized)
+	h.Realm = d.Realm
+	if h.Realm == "" {
+		h.Realm = "gateway"
+	}
+	h.Digest = d.Digest
+	if h.nonceCount == nil {
+		h.nonceCount = newDigestNonceCount()
+	}
+	h.nonceTTL = time.Duration(d.NonceTTL) * time.Millisecond
+	if h.nonceTTL < 1 {
+		h.nonceTTL = 5 * time.Minute
+	}
+	if d.NonceSecret != "" {
+		h.nonceKey = []byte(d.NonceSecret)
+	} else if h.nonceKey == nil {
+		h.nonceKey = make([]byte, 32)
+		_, err := rand.Read(h.nonceKey)
+		if err != nil {
+			return err
+		}
+	}
+	h.ClaimHeader = d.ClaimHeader
+	return nil
+}
+
+// Create a new BasicAuthInterceptor
+func NewBasicAuthInterceptor(data interface{}) (Handler, error) {
+	var d *BasicAuthInterceptorData
+	switch v := data.(type) {
+	case *BasicAuthInterceptorData:
+		d = v
+	case string:
+		d = new(BasicAuthInterceptorData)
+		err := json.Unmarshal([]byte(v), d)
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		d = new(BasicAuthInterceptorData)
+		err := Map2Struct(v, d)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
+	}
+	h := new(BasicAuthInterceptor)
+	err := h.Update(d)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_BasicAuthVerify(t *testing.T) {
+	if apr1("password", "saltsalt") != "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/" {
+		t.FailNow()
+	}
+	for _, secret := range []string{
+		"$2y$04$xPGtsIrnOVu5SHjtmKKGHek.DcA8OakZFJJa08BXfWbTyiTgYMp5G",
+		"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+		"$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/",
+		"{HA1}" + md5Hex("user:gateway:password"),
+		"{PLAIN}password",
+	} {
+		ok, err := basicAuthVerify(secret, "user", "gateway", "password")
+		if !ok || err != nil {
+			t.Fatal(secret)
+		}
+		ok, _ = basicAuthVerify(secret, "user", "gateway", "other")
+		if ok {
+			t.Fatal(secret)
+		}
+	}
+	// Invalid or unsupported format,the secret itself can't be password.
+	for _, secret := range []string{
+		"$2y$10$xxx",
+		"$5$saltsalt$qMM6BdJxvE0nKiJsaMJuC6RxSXRJjzpqRtTl1kGVVXB",
+		"$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/",
+		"abJnggxhB/yWI",
+		"password",
+	} {
+		ok, err := basicAuthVerify(secret, "user", "gateway", secret)
+		if ok || err == nil {
+			t.Fatal(secret)
+		}
+	}
+}
+
+func Test_BasicAuthInterceptor(t *testing.T) {
+	f, err := ioutil.TempFile("", "htpasswd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# comment\nuser1:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\nuser2:$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/\n" +
+		"user3:$2y$04$xPGtsIrnOVu5SHjtmKKGHek.DcA8OakZFJJa08BXfWbTyiTgYMp5G\nuser4:{PLAIN}password\nuser5:abJnggxhB/yWI\n")
+	f.Close()
+	h, err := NewHandler(BasicAuthInterceptorRegisterName(), &BasicAuthInterceptorData{
+		Realm:       "admin",
+		File:        f.Name(),
+		ClaimHeader: map[string]string{"sub": "X-User-Id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	for _, user := range []string{"user1", "user2", "user3", "user4"} {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+		req.SetBasicAuth(user, "password")
+		c, res := testHandle(h, "", req)
+		if res.statusCode != 0 || c.Identity().Subject != user || c.Req.Header.Get("X-User-Id") != user {
+			t.Fatal(user)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	req.SetBasicAuth("user1", "other")
+	_, res := testHandle(h, "", req)
+	if res.statusCode != http.StatusUnauthorized || res.Header().Get("WWW-Authenticate") != `Basic realm="admin", charset="UTF-8"` {
+		t.FailNow()
+	}
+	req, _ = http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	req.SetBasicAuth("user3", "other")
+	_, res = testHandle(h, "", req)
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	// Unsupported crypt hash is not plain text.
+	req, _ = http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	req.SetBasicAuth("user5", "abJnggxhB/yWI")
+	_, res = testHandle(h, "", req)
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+}
+
+func Test_DigestAuth(t *testing.T) {
+	h, err := NewHandler(BasicAuthInterceptorRegisterName(), &BasicAuthInterceptorData{
+		Digest: true,
+		User:   map[string]string{"user1": "password", "user2": "{HA1}" + md5Hex("user2:gateway:password")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	// Challenge.
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	_, res := testHandle(h, "", req)
+	challenge := res.Header()["Www-Authenticate"]
+	if res.statusCode != http.StatusUnauthorized || len(challenge) != 2 {
+		t.FailNow()
+	}
+	nonce := parseDigestParams(challenge[1][len("Digest "):])["nonce"]
+	digest := func(user, password, nonce, nc string) *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/a?b=1", nil)
+		req.RequestURI = "/a?b=1"
+		ha1 := md5Hex(user + ":gateway:" + password)
+		ha2 := md5Hex("GET:/a?b=1")
+		response := md5Hex(ha1 + ":" + nonce + ":" + nc + ":abc:auth:" + ha2)
+		req.Header.Set("Authorization", fmt.Sprintf(`Digest username="%s", realm="gateway", nonce="%s", uri="/a?b=1", qop=auth, nc=%s, cnonce="abc", response="%s", algorithm=MD5`,
+			user, nonce, nc, response))
+		return req
+	}
+	// Every challenge has a new nonce.
+	_, res = testHandle(h, "", req)
+	nonce2 := parseDigestParams(res.Header()["Www-Authenticate"][1][len("Digest "):])["nonce"]
+	if nonce2 == nonce {
+		t.FailNow()
+	}
+	for user, nonce := range map[string]string{"user1": nonce, "user2": nonce2} {
+		c, res := testHandle(h, "", digest(user, "password", nonce, "00000001"))
+		if res.statusCode != 0 || c.Identity().Subject != user {
+			t.Fatal(user)
+		}
+	}
+	// Replay,nonce count must increase.
+	_, res = testHandle(h, "", digest("user1", "password", nonce, "00000001"))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	_, res = testHandle(h, "", digest("user1", "password", nonce, "00000002"))
+	if res.statusCode != 0 {
+		t.FailNow()
+	}
+	_, res = testHandle(h, "", digest("user1", "password", nonce, "00000002"))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	// Wrong password and fake nonce.
+	_, res = testHandle(h, "", digest("user1", "other", nonce, "00000003"))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	_, res = testHandle(h, "", digest("user1", "password", strings.Repeat("A", len(nonce)), "00000001"))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+}
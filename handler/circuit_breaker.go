@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	// CircuitBreaker register name.
+	circuitBreakerRegisterName = HandlerName(&CircuitBreaker{})
+)
+
+func init() {
+	// Register CircuitBreaker.
+	RegisterHandler(circuitBreakerRegisterName, NewCircuitBreaker)
+}
+
+// Get CircuitBreaker register name.
+func CircuitBreakerRegisterName() string {
+	return circuitBreakerRegisterName
+}
+
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// Use in forward chain before forwarder.
+// It tracks failures(5xx,no response or too slow) of the rest of the chain,
+// when failure rate is too high,circuit opens and requests will get fallback response.
+// After OpenTime,circuit half-opens and lets a few requests probe recovery.
+type CircuitBreaker struct {
+	InterceptData
+	sync.Mutex
+	// Failure rate to open circuit,percent.
+	FailureRate int
+	// Request slower than it counts as failure.
+	SlowTime time.Duration
+	// Minimum requests in window before circuit can open.
+	MinRequests int
+	// Statistics window.
+	Window time.Duration
+	// How long circuit keeps open.
+	OpenTime time.Duration
+	// Probe requests in half-open state.
+	HalfOpenRequests int
+	// Circuit state.
+	state int
+	// Statistics window start time.
+	windowStart time.Time
+	// Requests and failures in window.
+	requests int
+	failures int
+	// Open state end time.
+	openUntil time.Time
+	// Requests and successes in half-open state.
+	probes    int
+	successes int
+}
+
+func (h *CircuitBreaker) Release() {}
+
+func (h *CircuitBreaker) Handle(c *Context) bool {
+	if !h.allow() {
+		h.InterceptData.WriteToResponse(c.Res)
+		return false
+	}
+	start := time.Now()
+	res := &statusResponseWriter{ResponseWriter: c.Res}
+	c.Res = res
+	c.Defer(func() {
+		c.Res = res.ResponseWriter
+		h.record(res.statusCode > 0 && res.statusCode < http.StatusInternalServerError &&
+			(h.SlowTime < 1 || time.Since(start) < h.SlowTime))
+	})
+	return true
+}
+
+// Return true if request can pass.
+func (h *CircuitBreaker) allow() bool {
+	h.Lock()
+	defer h.Unlock()
+	switch h.state {
+	case circuitOpen:
+		if time.Now().Before(h.openUntil) {
+			return false
+		}
+		h.state = circuitHalfOpen
+		h.probes = 0
+		h.successes = 0
+		fallthrough
+	case circuitHalfOpen:
+		if h.probes >= h.HalfOpenRequests {
+			return false
+		}
+		h.probes++
+	}
+	return true
+}
+
+// Record request result.
+func (h *CircuitBreaker) record(ok bool) {
+	h.Lock()
+	defer h.Unlock()
+	now := time.Now()
+	switch h.state {
+	case circuitClosed:
+		if now.Sub(h.windowStart) >= h.Window {
+			h.windowStart = now
+			h.requests = 0
+			h.failures = 0
+		}
+		h.requests++
+		if ok {
+			return
+		}
+		h.failures++
+		if h.requests >= h.MinRequests && h.failures*100 >= h.FailureRate*h.requests {
+			h.open(now)
+		}
+	case circuitHalfOpen:
+		if !ok {
+			h.open(now)
+			return
+		}
+		h.successes++
+		if h.successes >= h.HalfOpenRequests {
+			h.state = circuitClosed
+			h.windowStart = now
+			h.requests = 0
+			h.failures = 0
+		}
+	}
+}
+
+func (h *CircuitBreaker) open(now time.Time) {
+	h.state = circuitOpen
+	h.openUntil = now.Add(h.OpenTime)
+}
+
+type CircuitBreakerData struct {
+	// Fallback response when circuit is open.
+	InterceptData
+	// Failure rate to open circuit,percent,default is 50.
+	FailureRate int `json:"failureRate"`
+	// Request slower than it counts as failure,millisecond.
+	// If it's 0,don't check.
+	SlowTime int `json:"slowTime"`
+	// Minimum requests in window before circuit can open,default is 20.
+	MinRequests int `json:"minRequests"`
+	// Statistics window,millisecond,default is 10000.
+	Window int `json:"window"`
+	// How long circuit keeps open,millisecond,default is 5000.
+	OpenTime int `json:"openTime"`
+	// Probe requests in half-open state,default is 1.
+	HalfOpenRequests int `json:"halfOpenRequests"`
+}
+
+// Update CircuitBreaker,data is *CircuitBreakerData.
+func (h *CircuitBreaker) Update(data interface{}) error {
+	d, ok := data.(*CircuitBreakerData)
+	if !ok {
+		return errors.New(`data must be "*CircuitBreakerData" type`)
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.InterceptData = d.InterceptData
+	h.InterceptData.Check(http.StatusServiceUnavailable)
+	h.FailureRate = d.FailureRate
+	if h.FailureRate < 1 || h.FailureRate > 100 {
+		h.FailureRate = 50
+	}
+	h.SlowTime = time.Duration(d.SlowTime) * time.Millisecond
+	h.MinRequests = d.MinRequests
+	if h.MinRequests < 1 {
+		h.MinRequests = 20
+	}
+	h.Window = time.Duration(d.Window) * time.Millisecond
+	if h.Window < 1 {
+		h.Window = 10 * time.Second
+	}
+	h.OpenTime = time.Duration(d.OpenTime) * time.Millisecond
+	if h.OpenTime < 1 {
+		h.OpenTime = 5 * time.Second
+	}
+	h.HalfOpenRequests = d.HalfOpenRequests
+	if h.HalfOpenRequests < 1 {
+		h.HalfOpenRequests = 1
+	}
+	return nil
+}
+
+// Create a new CircuitBreaker
+func NewCircuitBreaker(data interface{}) (Handler, error) {
+	var d *CircuitBreakerData
+	switch v := data.(type) {
+	case *CircuitBreakerData:
+		d = v
+	case nil:
+		d = new(CircuitBreakerData)
+	case string:
+		d = new(CircuitBreakerData)
+		err := json.Unmarshal([]byte(v), d)
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		d = new(CircuitBreakerData)
+		err := Map2Struct(v, d)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
+	}
+	h := new(CircuitBreaker)
+	err := h.Update(d)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Record response status code.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *statusResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		// Upgraded connection is not a failure.
+		if w.statusCode == 0 {
+			w.statusCode = http.StatusSwitchingProtocols
+		}
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack not supported")
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_CircuitBreaker(t *testing.T) {
+	var data CircuitBreakerData
+	data.StatusCode = 503
+	data.ContentType = mime.TypeByExtension(".json")
+	data.Message = `{"message": "Service unavailable!"}`
+	data.FailureRate = 50
+	data.MinRequests = 4
+	data.OpenTime = 50
+	data.HalfOpenRequests = 2
+	h, err := NewHandler(CircuitBreakerRegisterName(), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Call chain,forwarder response statusCode.
+	call := func(statusCode int) (*testResponse, bool) {
+		res := &testResponse{}
+		var c Context
+		c.Res = res
+		ok := h.Handle(&c)
+		if ok && statusCode > 0 {
+			c.Res.WriteHeader(statusCode)
+		}
+		c.RunDefer()
+		if c.Res != res {
+			t.FailNow()
+		}
+		return res, ok
+	}
+	// Closed.
+	for _, code := range []int{200, 500, 200} {
+		if _, ok := call(code); !ok {
+			t.FailNow()
+		}
+	}
+	// Failure rate 50%,open.
+	if _, ok := call(0); !ok {
+		t.FailNow()
+	}
+	res, ok := call(200)
+	if ok || res.statusCode != data.StatusCode || res.Header().Get("Content-Type") != data.ContentType || res.body.String() != data.Message {
+		t.FailNow()
+	}
+	// Half-open,probe failed,open again.
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := call(502); !ok {
+		t.FailNow()
+	}
+	if _, ok := call(200); ok {
+		t.FailNow()
+	}
+	// Half-open,probe succeeded,closed.
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := call(200); !ok {
+		t.FailNow()
+	}
+	if _, ok := call(200); !ok {
+		t.FailNow()
+	}
+	for i := 0; i < 3; i++ {
+		if _, ok := call(http.StatusInternalServerError); !ok {
+			t.FailNow()
+		}
+	}
+}
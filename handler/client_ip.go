@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Client ip headers.
+const (
+	ClientIPHeaderXForwardedFor = "x-forwarded-for"
+	ClientIPHeaderXRealIP       = "x-real-ip"
+)
+
+var (
+	// Global client ip resolver,value is *ClientIPResolver.
+	clientIPResolver atomic.Value
+)
+
+func init() {
+	clientIPResolver.Store(new(ClientIPResolver))
+}
+
+// Client ip resolver initial data.
+type ClientIPData struct {
+	// Trusted proxy ip or CIDR like "10.0.0.0/8".
+	// Only request comes from trusted proxy will use headers.
+	TrustedProxy []string `json:"trustedProxy"`
+	// Headers in order of preference,"x-forwarded-for" or "x-real-ip".
+	// Default is "x-forwarded-for","x-real-ip".
+	Header []string `json:"header"`
+	// Accept PROXY protocol(v1 and v2) header from trusted proxy.
+	// Gateway listener will use the address in it as remote address.
+	ProxyProtocol bool `json:"proxyProtocol"`
+}
+
+// Resolve real client ip of request.
+type ClientIPResolver struct {
+	trusted ipNets
+	header  []string
+}
+
+// Create a new ClientIPResolver,data can be nil.
+func NewClientIPResolver(data *ClientIPData) (*ClientIPResolver, error) {
+	r := new(ClientIPResolver)
+	if data == nil {
+		return r, nil
+	}
+	var err error
+	r.trusted, err = parseIPNets(data.TrustedProxy)
+	if err != nil {
+		return nil, fmt.Errorf(`"clientIP"."trustedProxy" %s`, err.Error())
+	}
+	header := data.Header
+	if len(header) < 1 {
+		header = []string{ClientIPHeaderXForwardedFor, ClientIPHeaderXRealIP}
+	}
+	for _, s := range header {
+		s = strings.ToLower(s)
+		if s != ClientIPHeaderXForwardedFor && s != ClientIPHeaderXRealIP {
+			return nil, fmt.Errorf(`"clientIP"."header" invalid value "%s"`, s)
+		}
+		r.header = append(r.header, s)
+	}
+	return r, nil
+}
+
+// Return true if ip is a trusted proxy.
+func (r *ClientIPResolver) Trusted(ip string) bool {
+	return r.trusted.Contains(net.ParseIP(ip))
+}
+
+// Return real client ip of request.
+func (r *ClientIPResolver) Resolve(req *http.Request) string {
+	ip := remoteIP(req)
+	if !r.Trusted(ip) {
+		return ip
+	}
+	for _, s := range r.header {
+		switch s {
+		case ClientIPHeaderXForwardedFor:
+			// From right to left,the first one which is not trusted proxy.
+			var a []string
+			for _, v := range req.Header["X-Forwarded-For"] {
+				a = append(a, strings.Split(v, ",")...)
+			}
+			client := ""
+			for i := len(a) - 1; i >= 0; i-- {
+				v := strings.TrimSpace(a[i])
+				if net.ParseIP(v) == nil {
+					break
+				}
+				client = v
+				if !r.Trusted(v) {
+					break
+				}
+			}
+			if client != "" {
+				return client
+			}
+		case ClientIPHeaderXRealIP:
+			v := strings.TrimSpace(req.Header.Get("X-Real-Ip"))
+			if net.ParseIP(v) != nil {
+				return v
+			}
+		}
+	}
+	return ip
+}
+
+// Set global client ip resolver,data can be nil.
+func SetClientIPResolver(data *ClientIPData) error {
+	r, err := NewClientIPResolver(data)
+	if err != nil {
+		return err
+	}
+	clientIPResolver.Store(r)
+	return nil
+}
+
+// Return global client ip resolver.
+func GetClientIPResolver() *ClientIPResolver {
+	return clientIPResolver.Load().(*ClientIPResolver)
+}
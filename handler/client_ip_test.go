@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_ClientIPResolver(t *testing.T) {
+	r, err := NewClientIPResolver(&ClientIPData{
+		TrustedProxy: []string{"10.0.0.0/8", "::1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "6.6.6.6, 1.1.1.1, 10.0.0.2")
+	req.Header.Set("X-Real-Ip", "2.2.2.2")
+	// Untrusted peer.
+	req.RemoteAddr = "192.168.1.2:1234"
+	if r.Resolve(req) != "192.168.1.2" {
+		t.FailNow()
+	}
+	// Trusted peer,skip trusted proxies from right to left.
+	req.RemoteAddr = "10.0.0.1:1234"
+	if r.Resolve(req) != "1.1.1.1" {
+		t.FailNow()
+	}
+	req.RemoteAddr = "[::1]:1234"
+	if r.Resolve(req) != "1.1.1.1" {
+		t.FailNow()
+	}
+	// All trusted,use the left most.
+	req.Header.Set("X-Forwarded-For", "10.0.0.3, 10.0.0.2")
+	if r.Resolve(req) != "10.0.0.3" {
+		t.FailNow()
+	}
+	// X-Real-Ip.
+	req.Header.Del("X-Forwarded-For")
+	if r.Resolve(req) != "2.2.2.2" {
+		t.FailNow()
+	}
+	// Invalid.
+	_, err = NewClientIPResolver(&ClientIPData{Header: []string{"x-unknown"}})
+	if err == nil {
+		t.FailNow()
+	}
+}
+
+func Test_ContextClientIP(t *testing.T) {
+	err := SetClientIPResolver(&ClientIPData{TrustedProxy: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetClientIPResolver(nil)
+	var c Context
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Real-Ip", "2001:db8::1")
+	c.Reset(nil, req)
+	if c.ClientIP() != "2001:db8::1" {
+		t.FailNow()
+	}
+	// Reset clears cache.
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "[2001:db8::2]:1234"
+	c.Reset(nil, req)
+	if c.ClientIP() != "2001:db8::2" {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// CORSHandler register name.
+	corsHandlerRegisterName = HandlerName(&CORSHandler{})
+)
+
+func init() {
+	// Register CORSHandler.
+	RegisterHandler(corsHandlerRegisterName, NewCORSHandler)
+}
+
+// Get CORSHandler register name.
+func CORSHandlerRegisterName() string {
+	return corsHandlerRegisterName
+}
+
+// Return true if request is a CORS preflight request.
+func IsCORSPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions &&
+		req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// A Handler that answers CORS preflight request itself,and adds CORS headers to actual response.
+// Use it in intercept chain before authentication handlers,or in forward chain before forwarder.
+type CORSHandler struct {
+	// Value is *corsPolicy,replaced by Update.
+	policy atomic.Value
+}
+
+// Compiled CORSHandlerData.
+type corsPolicy struct {
+	// Response of disallowed preflight request,default status code is 403.
+	InterceptData
+	// Allow all origins.
+	allowAll bool
+	// Exact origins,lower case.
+	origin map[string]int
+	// Wildcard and regular expression origins.
+	originRegexp []*regexp.Regexp
+	// Allowed methods,upper case.
+	method map[string]int
+	// "Access-Control-Allow-Methods" value.
+	methodValue string
+	// Allowed headers,lower case,nil means allow all request headers.
+	header map[string]int
+	// "Access-Control-Expose-Headers" value.
+	exposeHeader string
+	// "Access-Control-Allow-Credentials".
+	allowCredentials bool
+	// "Access-Control-Max-Age" value.
+	maxAge string
+	// Preflight response status code.
+	preflightStatusCode int
+}
+
+func (h *CORSHandler) Release() {
+}
+
+func (h *CORSHandler) Handle(c *Context) bool {
+	p := h.policy.Load().(*corsPolicy)
+	origin := c.Req.Header.Get("Origin")
+	if IsCORSPreflight(c.Req) {
+		if !p.preflight(c.Res.Header(), c.Req, origin) {
+			p.InterceptData.WriteToResponse(c.Res)
+			return false
+		}
+		c.Res.WriteHeader(p.preflightStatusCode)
+		return false
+	}
+	if origin == "" {
+		return true
+	}
+	header := c.Res.Header()
+	if !p.allowOrigin(origin) {
+		header.Add("Vary", "Origin")
+		return true
+	}
+	p.setOrigin(header, origin)
+	if p.exposeHeader != "" {
+		header.Set("Access-Control-Expose-Headers", p.exposeHeader)
+	}
+	return true
+}
+
+// Set preflight response headers,return false if request is not allowed.
+func (p *corsPolicy) preflight(header http.Header, req *http.Request, origin string) bool {
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	if !p.allowOrigin(origin) {
+		return false
+	}
+	method := strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+	if _, ok := p.method[method]; !ok {
+		return false
+	}
+	// Request headers,comma separated.
+	var requestHeader []string
+	for _, v := range req.Header.Values("Access-Control-Request-Headers") {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if s == "" {
+				continue
+			}
+			if p.header != nil {
+				if _, ok := p.header[s]; !ok {
+					return false
+				}
+			}
+			requestHeader = append(requestHeader, s)
+		}
+	}
+	p.setOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", p.methodValue)
+	if len(requestHeader) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requestHeader, ", "))
+	}
+	if p.maxAge != "" {
+		header.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	return true
+}
+
+// Set "Access-Control-Allow-Origin" and "Access-Control-Allow-Credentials".
+func (p *corsPolicy) setOrigin(header http.Header, origin string) {
+	if p.allowAll && !p.allowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if p.allowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	header.Add("Vary", "Origin")
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := p.origin[origin]; ok {
+		return true
+	}
+	for _, exp := range p.originRegexp {
+		if exp.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+type CORSHandlerData struct {
+	// Response of disallowed preflight request,default status code is 403.
+	InterceptData
+	// Allowed origins,"*" means all,"https://*.example.com" is wildcard,other value is exact origin.
+	AllowOrigin []string `json:"allowOrigin"`
+	// Allowed origin regular expressions,like "^https://[a-z]+\\.example\\.com$".
+	AllowOriginRegexp []string `json:"allowOriginRegexp"`
+	// Allowed methods,default is "GET","HEAD","PUT","PATCH","POST","DELETE".
+	AllowMethod []string `json:"allowMethod"`
+	// Allowed request headers,empty or "*" means all headers requested by client.
+	AllowHeader []string `json:"allowHeader"`
+	// Response headers can be read by client.
+	ExposeHeader []string `json:"exposeHeader"`
+	// Allow cookies and credentials,"*" origin will response the request origin.
+	AllowCredentials bool `json:"allowCredentials"`
+	// How long client can cache preflight result,second,0 means not set.
+	MaxAge int `json:"maxAge"`
+	// Preflight response status code,default is 204.
+	PreflightStatusCode int `json:"preflightStatusCode"`
+}
+
+// Update CORSHandler,data is *CORSHandlerData.
+// It's safe to update while handling requests.
+func (h *CORSHandler) Update(data interface{}) error {
+	d, ok := data.(*CORSHandlerData)
+	if !ok {
+		return errors.New(`data must be "*CORSHandlerData" type`)
+	}
+	p := new(corsPolicy)
+	p.origin = make(map[string]int)
+	for _, s := range d.AllowOrigin {
+		s = strings.ToLower(s)
+		if s == "*" {
+			p.allowAll = true
+			continue
+		}
+		if strings.Contains(s, "*") {
+			exp, err := regexp.Compile("^" + strings.Replace(regexp.QuoteMeta(s), `\*`, `[^/]+`, -1) + "$")
+			if err != nil {
+				return fmt.Errorf(`origin "%s" %s`, s, err.Error())
+			}
+			p.originRegexp = append(p.originRegexp, exp)
+			continue
+		}
+		p.origin[s] = 1
+	}
+	for _, s := range d.AllowOriginRegexp {
+		exp, err := regexp.Compile(s)
+		if err != nil {
+			return fmt.Errorf(`origin regexp "%s" %s`, s, err.Error())
+		}
+		p.originRegexp = append(p.originRegexp, exp)
+	}
+	var method []string
+	for _, s := range d.AllowMethod {
+		method = append(method, strings.ToUpper(s))
+	}
+	if len(method) < 1 {
+		method = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete}
+	}
+	p.method = make(map[string]int)
+	for _, s := range method {
+		p.method[s] = 1
+	}
+	p.methodValue = strings.Join(method, ", ")
+	if len(d.AllowHeader) > 0 {
+		p.header = make(map[string]int)
+		for _, s := range d.AllowHeader {
+			if s == "*" {
+				p.header = nil
+				break
+			}
+			p.header[strings.ToLower(s)] = 1
+		}
+	}
+	p.exposeHeader = strings.Join(d.ExposeHeader, ", ")
+	p.allowCredentials = d.AllowCredentials
+	if d.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(d.MaxAge)
+	}
+	p.preflightStatusCode = d.PreflightStatusCode
+	if p.preflightStatusCode < 1 {
+		p.preflightStatusCode = http.StatusNoContent
+	}
+	p.InterceptData = d.InterceptData
+	p.InterceptData.Check(http.StatusForbidden)
+	h.policy.Store(p)
+	return nil
+}
+
+// Create a new CORSHandler
+func NewCORSHandler(data interface{}) (Handler, error) {
+	var d *CORSHandlerData
+	switch v := data.(type) {
+	case *CORSHandlerData:
+		d = v
+	case string:
+		d = new(CORSHandlerData)
+		err := json.Unmarshal([]byte(v), d)
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		d = new(CORSHandlerData)
+		err := Map2Struct(v, d)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
+	}
+	h := new(CORSHandler)
+	err := h.Update(d)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func Test_CORSHandler(t *testing.T) {
+	h, err := NewCORSHandler(map[string]interface{}{
+		"allowOrigin":       []interface{}{"https://a.example.com", "https://*.b.example.com"},
+		"allowOriginRegexp": []interface{}{`^https://c[0-9]\.example\.com$`},
+		"allowMethod":       []interface{}{"get", "post"},
+		"allowHeader":       []interface{}{"Content-Type", "Authorization"},
+		"exposeHeader":      []interface{}{"X-Request-Id"},
+		"allowCredentials":  true,
+		"maxAge":            600,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	call := func(method, origin string, header map[string]string) (bool, *testResponse) {
+		req, err := http.NewRequest(method, "http://127.0.0.1/api", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", origin)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		var c Context
+		res := new(testResponse)
+		c.Reset(res, req)
+		return h.Handle(&c), res
+	}
+	// Preflight.
+	preflight := map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type, authorization",
+	}
+	for _, origin := range []string{"https://a.example.com", "https://x.y.b.example.com", "https://c1.example.com"} {
+		ok, res := call(http.MethodOptions, origin, preflight)
+		if ok || res.statusCode != http.StatusNoContent {
+			t.Fatal(origin)
+		}
+		header := res.Header()
+		if header.Get("Access-Control-Allow-Origin") != origin ||
+			header.Get("Access-Control-Allow-Credentials") != "true" ||
+			header.Get("Access-Control-Allow-Methods") != "GET, POST" ||
+			header.Get("Access-Control-Allow-Headers") != "content-type, authorization" ||
+			header.Get("Access-Control-Max-Age") != "600" {
+			t.Fatal(origin)
+		}
+	}
+	// Disallowed preflight.
+	for _, v := range []struct {
+		origin string
+		header map[string]string
+	}{
+		{"https://b.example.com", preflight},
+		{"https://a.example.com.evil.com", preflight},
+		{"https://a.example.com", map[string]string{"Access-Control-Request-Method": "DELETE"}},
+		{"https://a.example.com", map[string]string{"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Other"}},
+	} {
+		ok, res := call(http.MethodOptions, v.origin, v.header)
+		if ok || res.statusCode != http.StatusForbidden || res.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatal(v.origin)
+		}
+	}
+	// Actual request.
+	ok, res := call(http.MethodGet, "https://a.example.com", nil)
+	if !ok || res.Header().Get("Access-Control-Allow-Origin") != "https://a.example.com" ||
+		res.Header().Get("Access-Control-Expose-Headers") != "X-Request-Id" || res.Header().Get("Vary") != "Origin" {
+		t.FailNow()
+	}
+	ok, res = call(http.MethodGet, "https://d.example.com", nil)
+	if !ok || res.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.FailNow()
+	}
+	// Allow all.
+	err = h.Update(&CORSHandlerData{AllowOrigin: []string{"*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, res = call(http.MethodOptions, "https://d.example.com", map[string]string{
+		"Access-Control-Request-Method":  "PUT",
+		"Access-Control-Request-Headers": "X-Any",
+	})
+	if ok || res.statusCode != http.StatusNoContent || res.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		res.Header().Get("Access-Control-Allow-Headers") != "x-any" {
+		t.FailNow()
+	}
+}
+
+func Test_CORSHandlerUpdate(t *testing.T) {
+	h, err := NewCORSHandler(&CORSHandlerData{AllowOrigin: []string{"https://*.a.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	// Invalid data keeps current policy.
+	if h.Update(&CORSHandlerData{AllowOriginRegexp: []string{"["}}) == nil {
+		t.FailNow()
+	}
+	handle := func() string {
+		req := httptest.NewRequest(http.MethodGet, "http://127.0.0.1/api", nil)
+		req.Header.Set("Origin", "https://x.a.example.com")
+		var c Context
+		res := new(testResponse)
+		c.Reset(res, req)
+		h.Handle(&c)
+		return res.Header().Get("Access-Control-Allow-Origin")
+	}
+	if handle() != "https://x.a.example.com" {
+		t.FailNow()
+	}
+	// Update while handling.
+	var wait sync.WaitGroup
+	wait.Add(2)
+	go func() {
+		defer wait.Done()
+		for i := 0; i < 100; i++ {
+			h.Update(&CORSHandlerData{AllowOrigin: []string{"https://*.a.example.com", "https://b.example.com"}})
+		}
+	}()
+	go func() {
+		defer wait.Done()
+		for i := 0; i < 100; i++ {
+			handle()
+		}
+	}()
+	wait.Wait()
+	if handle() != "https://x.a.example.com" {
+		t.FailNow()
+	}
+}
+
+func Test_CORSHandlerForward(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Access-Control-Allow-Origin", "*")
+		rw.Header().Set("Vary", "Accept-Encoding")
+		io.WriteString(rw, "ok")
+	}))
+	defer server.Close()
+	cors, err := NewCORSHandler(&CORSHandlerData{AllowOrigin: []string{"https://a.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarder, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		Upstream: []*UpstreamData{{Url: server.URL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer forwarder.Release()
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "https://a.example.com")
+	var c Context
+	res := new(testResponse)
+	c.Reset(res, req)
+	if !cors.Handle(&c) {
+		t.FailNow()
+	}
+	forwarder.Handle(&c)
+	// Gateway CORS headers replace upstream ones,"Vary" is merged.
+	if res.body.String() != "ok" || len(res.Header()["Access-Control-Allow-Origin"]) != 1 ||
+		res.Header().Get("Access-Control-Allow-Origin") != "https://a.example.com" || len(res.Header()["Vary"]) != 2 {
+		t.FailNow()
+	}
+}
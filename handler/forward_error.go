@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+const (
+	// Failed to connect upstream.
+	ForwardErrorConnect = "connect"
+	// Upstream didn't response in time.
+	ForwardErrorTimeout = "timeout"
+	// Connection was reset or closed by upstream.
+	ForwardErrorReset = "reset"
+	// TLS handshake or certificate verification failed.
+	ForwardErrorTLS = "tls"
+	// Other errors.
+	ForwardErrorOther = "other"
+	// No upstream is available.
+	ForwardErrorUnavailable = "unavailable"
+)
+
+// Return error class of forward request,ForwardErrorXXX.
+func ForwardErrorClass(err error) string {
+	var tlsErr tls.RecordHeaderError
+	var certErr x509.CertificateInvalidError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &tlsErr), errors.As(err, &certErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr):
+		return ForwardErrorTLS
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		// TLS alert from upstream,like client certificate is rejected.
+		return ForwardErrorTLS
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		if opErr.Timeout() {
+			return ForwardErrorTimeout
+		}
+		return ForwardErrorConnect
+	case errors.Is(err, context.DeadlineExceeded):
+		return ForwardErrorTimeout
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ForwardErrorReset
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return ForwardErrorTimeout
+	}
+	return ForwardErrorOther
+}
+
+// Default status code of error class.
+var forwardErrorStatusCode = map[string]int{
+	ForwardErrorConnect:     http.StatusBadGateway,
+	ForwardErrorTimeout:     http.StatusGatewayTimeout,
+	ForwardErrorReset:       http.StatusBadGateway,
+	ForwardErrorTLS:         http.StatusBadGateway,
+	ForwardErrorOther:       http.StatusBadGateway,
+	ForwardErrorUnavailable: http.StatusServiceUnavailable,
+}
+
+// Create error responses of all error classes.
+// Arg data is custom responses,key is error class.
+func newForwardErrorResponse(data map[string]*InterceptData) (map[string]*InterceptData, error) {
+	response := make(map[string]*InterceptData)
+	for k, v := range data {
+		if _, ok := forwardErrorStatusCode[k]; !ok {
+			return nil, fmt.Errorf(`"errorResponse" invalid error class "%s"`, k)
+		}
+		d := new(InterceptData)
+		if v != nil {
+			*d = *v
+		}
+		d.Check(forwardErrorStatusCode[k])
+		response[k] = d
+	}
+	for k, v := range forwardErrorStatusCode {
+		if _, ok := response[k]; !ok {
+			d := &InterceptData{StatusCode: v, Message: http.StatusText(v)}
+			d.Check(v)
+			response[k] = d
+		}
+	}
+	return response, nil
+}
+
+// Write error response of error class,if client is still waiting.
+func (h *DefaultForwarder) writeError(c *Context, class string) {
+	if c.Req.Context().Err() != nil {
+		return
+	}
+	c.Res.Header().Set(h.ErrorHeader, class)
+	h.ErrorResponse[class].WriteToResponse(c.Res)
+}
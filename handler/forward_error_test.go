@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_ForwardErrorClass(t *testing.T) {
+	client := &http.Client{}
+	// Connect.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	_, err = client.Get("http://" + addr)
+	if err == nil || ForwardErrorClass(err) != ForwardErrorConnect {
+		t.Fatal(err)
+	}
+	// Reset.
+	ser := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, _, _ := rw.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer ser.Close()
+	_, err = client.Get(ser.URL)
+	if err == nil || ForwardErrorClass(err) != ForwardErrorReset {
+		t.Fatal(err)
+	}
+	// TLS.
+	tlsSer := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer tlsSer.Close()
+	_, err = client.Get(tlsSer.URL)
+	if err == nil || ForwardErrorClass(err) != ForwardErrorTLS {
+		t.Fatal(err)
+	}
+	// TLS to plain http upstream.
+	_, err = tls.Dial("tcp", ser.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err == nil || ForwardErrorClass(err) != ForwardErrorTLS {
+		t.Fatal(err)
+	}
+	// Hostname.
+	pool := x509.NewCertPool()
+	pool.AddCert(tlsSer.Certificate())
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "other.com"}}
+	_, err = client.Get(tlsSer.URL)
+	if err == nil || ForwardErrorClass(err) != ForwardErrorTLS {
+		t.Fatal(err)
+	}
+	// Client certificate required by upstream.
+	mtlsSer := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	mtlsSer.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	mtlsSer.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	mtlsSer.StartTLS()
+	defer mtlsSer.Close()
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	_, err = client.Get(mtlsSer.URL)
+	if err == nil || ForwardErrorClass(err) != ForwardErrorTLS {
+		t.Fatal(err)
+	}
+}
+
+func Test_DefaultForwarderError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+	var data NewDefaultForwarderData
+	data.Upstream = []*UpstreamData{{Url: "http://" + addr}, {Url: slow.URL}}
+	data.RequestTimeout = 20
+	data.HealthCheck = &HealthCheckData{PassiveFailures: 1}
+	data.ErrorResponse = map[string]*InterceptData{
+		ForwardErrorConnect: {
+			ContentType: mime.TypeByExtension(".json"),
+			Message:     `{"message": "Bad gateway!"}`,
+		},
+	}
+	h, err := NewHandler(DefaultForwarderName(), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func() *testResponse {
+		var c Context
+		c.Req, err = http.NewRequest(http.MethodGet, "http://127.0.0.1/service1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := new(testResponse)
+		c.Res = res
+		if h.Handle(&c) {
+			t.FailNow()
+		}
+		return res
+	}
+	check := func(res *testResponse, statusCode int, contentType, message, class string) {
+		if res.statusCode != statusCode || res.Header().Get("Content-Type") != contentType ||
+			res.body.String() != message || res.Header().Get("X-Gateway-Error") != class {
+			t.Fatal(res.statusCode, res.body.String())
+		}
+	}
+	html := mime.TypeByExtension(".html")
+	// Round-robin,slow upstream first.
+	check(call(), http.StatusGatewayTimeout, html, http.StatusText(http.StatusGatewayTimeout), ForwardErrorTimeout)
+	check(call(), http.StatusBadGateway, data.ErrorResponse[ForwardErrorConnect].ContentType,
+		data.ErrorResponse[ForwardErrorConnect].Message, ForwardErrorConnect)
+	// All upstreams are ejected.
+	check(call(), http.StatusServiceUnavailable, html, http.StatusText(http.StatusServiceUnavailable), ForwardErrorUnavailable)
+	// Invalid error class.
+	data.ErrorResponse = map[string]*InterceptData{"dns": {}}
+	if h.Update(&data) == nil {
+		t.FailNow()
+	}
+}
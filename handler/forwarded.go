@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Client info headers.
+const (
+	ForwardedHeaderXForwardedFor   = "x-forwarded-for"
+	ForwardedHeaderXForwardedProto = "x-forwarded-proto"
+	ForwardedHeaderXForwardedHost  = "x-forwarded-host"
+	ForwardedHeaderForwarded       = "forwarded"
+	ForwardedHeaderXRealIP         = "x-real-ip"
+)
+
+// Hop-by-hop headers,RFC 7230 section 6.1.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Remove hop-by-hop headers and headers listed in "Connection".
+func removeHopHeaders(header http.Header) {
+	for _, v := range header["Connection"] {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				header.Del(s)
+			}
+		}
+	}
+	for _, s := range hopHeaders {
+		header.Del(s)
+	}
+}
+
+// Client info headers initial data.
+type ForwardedData struct {
+	// Headers add to forward request,"x-forwarded-for","x-forwarded-proto","x-forwarded-host","forwarded" or "x-real-ip".
+	// Default is "x-forwarded-for","x-forwarded-proto","x-forwarded-host".
+	Header []string `json:"header"`
+}
+
+// Compiled ForwardedData.
+type forwardedHeader struct {
+	header map[string]int
+}
+
+func newForwardedHeader(d *ForwardedData) (*forwardedHeader, error) {
+	f := new(forwardedHeader)
+	f.header = make(map[string]int)
+	header := d.Header
+	if len(header) < 1 {
+		header = []string{ForwardedHeaderXForwardedFor, ForwardedHeaderXForwardedProto, ForwardedHeaderXForwardedHost}
+	}
+	for _, s := range header {
+		s = strings.ToLower(s)
+		switch s {
+		case ForwardedHeaderXForwardedFor, ForwardedHeaderXForwardedProto, ForwardedHeaderXForwardedHost,
+			ForwardedHeaderForwarded, ForwardedHeaderXRealIP:
+			f.header[s] = 1
+		default:
+			return nil, fmt.Errorf(`"forwarded"."header" invalid value "%s"`, s)
+		}
+	}
+	return f, nil
+}
+
+func (f *forwardedHeader) has(name string) bool {
+	_, ok := f.header[name]
+	return ok
+}
+
+// Set client info headers of forward request.
+// "x-real-ip" is the real client ip,others use the peer ip.
+// If peer is a trusted proxy of global ClientIPResolver,append to incoming headers,else overwrite them.
+func (f *forwardedHeader) Apply(c *Context, header http.Header) {
+	req := c.Req
+	ip := remoteIP(req)
+	trusted := GetClientIPResolver().Trusted(ip)
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	if f.has(ForwardedHeaderXForwardedFor) {
+		value := ip
+		if prior := strings.Join(req.Header["X-Forwarded-For"], ", "); trusted && prior != "" {
+			value = prior + ", " + ip
+		}
+		header.Set("X-Forwarded-For", value)
+	}
+	if f.has(ForwardedHeaderXForwardedProto) {
+		f.set(header, "X-Forwarded-Proto", proto, req, trusted)
+	}
+	if f.has(ForwardedHeaderXForwardedHost) {
+		f.set(header, "X-Forwarded-Host", req.Host, req, trusted)
+	}
+	if f.has(ForwardedHeaderXRealIP) {
+		header.Set("X-Real-Ip", c.ClientIP())
+	}
+	if f.has(ForwardedHeaderForwarded) {
+		value := fmt.Sprintf("for=%s;host=%s;proto=%s", forwardedNode(ip), forwardedValue(req.Host), proto)
+		if prior := strings.Join(req.Header["Forwarded"], ", "); trusted && prior != "" {
+			value = prior + ", " + value
+		}
+		header.Set("Forwarded", value)
+	}
+}
+
+// Keep incoming value from trusted proxy,else overwrite it.
+func (f *forwardedHeader) set(header http.Header, name, value string, req *http.Request, trusted bool) {
+	if prior := req.Header.Get(name); trusted && prior != "" {
+		value = prior
+	}
+	header.Set(name, value)
+}
+
+// Return node of "Forwarded" header,IPv6 must be quoted.
+func forwardedNode(ip string) string {
+	if strings.IndexByte(ip, ':') >= 0 {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+// Quote value of "Forwarded" header if it's not a token.
+func forwardedValue(s string) string {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0) {
+			return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+		}
+	}
+	return s
+}
+
+// Return ip of request peer.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// A list of ip networks.
+type ipNets []*net.IPNet
+
+// Parse ip or CIDR list.
+func parseIPNets(a []string) (ipNets, error) {
+	var nets ipNets
+	for _, s := range a {
+		if strings.IndexByte(s, '/') < 0 {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf(`invalid ip "%s"`, s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Return true if ip is in any of networks.
+func (n ipNets) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, s := range n {
+		if s.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_RemoveHopHeaders(t *testing.T) {
+	header := make(http.Header)
+	header.Set("Connection", "keep-alive, X-Hop")
+	header.Set("Keep-Alive", "timeout=5")
+	header.Set("X-Hop", "1")
+	header.Set("Transfer-Encoding", "chunked")
+	header.Set("X-End", "1")
+	removeHopHeaders(header)
+	if len(header) != 1 || header.Get("X-End") != "1" {
+		t.Fatal(header)
+	}
+}
+
+func Test_ForwardedHeader(t *testing.T) {
+	f, err := newForwardedHeader(&ForwardedData{
+		Header: []string{"X-Forwarded-For", "x-forwarded-proto", "x-forwarded-host", "forwarded", "x-real-ip"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Trusted proxies of global ClientIPResolver.
+	err = SetClientIPResolver(&ClientIPData{TrustedProxy: []string{"10.0.0.0/8", "::1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetClientIPResolver(nil)
+	var c Context
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Real-Ip", "1.1.1.1")
+	req.Header.Set("Forwarded", "for=1.1.1.1")
+	// Untrusted peer,overwrite.
+	req.RemoteAddr = "192.168.1.2:1234"
+	c.Reset(nil, req)
+	header := make(http.Header)
+	f.Apply(&c, header)
+	if header.Get("X-Forwarded-For") != "192.168.1.2" || header.Get("X-Forwarded-Proto") != "http" ||
+		header.Get("X-Forwarded-Host") != "example.com" || header.Get("X-Real-Ip") != "192.168.1.2" ||
+		header.Get("Forwarded") != "for=192.168.1.2;host=example.com;proto=http" {
+		t.Fatal(header)
+	}
+	// Trusted peer,append,"x-real-ip" is resolved client ip.
+	req.RemoteAddr = "10.1.1.1:1234"
+	c.Reset(nil, req)
+	header = make(http.Header)
+	f.Apply(&c, header)
+	if header.Get("X-Forwarded-For") != "1.1.1.1, 10.1.1.1" || header.Get("X-Forwarded-Proto") != "https" ||
+		header.Get("X-Real-Ip") != "1.1.1.1" ||
+		header.Get("Forwarded") != "for=1.1.1.1, for=10.1.1.1;host=example.com;proto=http" {
+		t.Fatal(header)
+	}
+	// IPv6.
+	req.RemoteAddr = "[::1]:1234"
+	req.Header.Del("Forwarded")
+	c.Reset(nil, req)
+	header = make(http.Header)
+	f.Apply(&c, header)
+	if header.Get("Forwarded") != `for="[::1]";host=example.com;proto=http` {
+		t.Fatal(header)
+	}
+	// Invalid.
+	_, err = newForwardedHeader(&ForwardedData{Header: []string{"x-unknown"}})
+	if err == nil {
+		t.FailNow()
+	}
+}
+
+func Test_IPNets(t *testing.T) {
+	nets, err := parseIPNets([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"10.2.3.4", "192.168.1.1", "2001:db8::1", "::ffff:10.0.0.1"} {
+		if !nets.Contains(net.ParseIP(s)) {
+			t.Fatal(s)
+		}
+	}
+	for _, s := range []string{"11.0.0.1", "192.168.1.2", "2001:db9::1"} {
+		if nets.Contains(net.ParseIP(s)) {
+			t.Fatal(s)
+		}
+	}
+}
+
+func Test_DefaultForwarderHopHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Hop") != "" || r.Header.Get("Proxy-Authorization") != "" ||
+			r.Header.Get("X-Forwarded-For") != "192.168.1.2" || r.Header.Get("X-Forwarded-Host") != "example.com" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rw.Header().Set("Connection", "X-Hop")
+		rw.Header().Set("X-Hop", "1")
+	}))
+	defer upstream.Close()
+	h, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		RequestUrl: upstream.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	var c Context
+	c.Req = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	c.Req.RemoteAddr = "192.168.1.2:1234"
+	c.Req.Header.Set("Connection", "X-Hop")
+	c.Req.Header.Set("X-Hop", "1")
+	c.Req.Header.Set("Proxy-Authorization", "Basic 123")
+	res := new(testResponse)
+	c.Res = res
+	if !h.Handle(&c) || res.statusCode != http.StatusOK || res.Header().Get("X-Hop") != "" {
+		t.FailNow()
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,11 +36,68 @@ func init() {
 type Context struct {
 	Res http.ResponseWriter
 	Req *http.Request
-	// Service route path.
-	// Top dir of request url path.
+	// Matched route name.
+	Route string
+	// Route path prefix.
+	// Forwarder will remove it from request url path.
 	Path string
+	// Route path params,like "id" of "/users/:id".
+	Param map[string]string
 	// Used for save and pass temp data in Handler call chain.
 	Data interface{}
+	// Upstream response in response chain,nil before upstream response is received.
+	Response *Response
+	// Response chain of matched route.
+	responseChain []Handler
+	// Functions called after Handler call chain.
+	deferFunc []func()
+	// Resolved client ip.
+	clientIP string
+}
+
+// Reset all fields for a new request.
+func (c *Context) Reset(res http.ResponseWriter, req *http.Request) {
+	c.Res = res
+	c.Req = req
+	c.Route = ""
+	c.Path = ""
+	for k := range c.Param {
+		delete(c.Param, k)
+	}
+	c.Data = nil
+	c.Response = nil
+	c.responseChain = nil
+	c.deferFunc = c.deferFunc[:0]
+	c.clientIP = ""
+}
+
+// Return real client ip,resolved by global ClientIPResolver.
+func (c *Context) ClientIP() string {
+	if c.clientIP == "" {
+		c.clientIP = GetClientIPResolver().Resolve(c.Req)
+	}
+	return c.clientIP
+}
+
+// Add a function which will be called after Handler call chain,like defer.
+func (c *Context) Defer(f func()) {
+	c.deferFunc = append(c.deferFunc, f)
+}
+
+// Call functions added by Defer in reverse order.
+func (c *Context) RunDefer() {
+	for i := len(c.deferFunc) - 1; i >= 0; i-- {
+		c.deferFunc[i]()
+	}
+	c.deferFunc = c.deferFunc[:0]
+}
+
+// Set route path param.
+func (c *Context) SetParam(name, value string) {
+	if c.Param == nil {
+		c.Param = make(map[string]string)
+	}
+	c.Param[name] = value
 }
 
 type Handler interface {
@@ -88,40 +147,174 @@ func DefaultForwarderName() string {
 // DefaultForwarder initial data.
 type NewDefaultForwarderData struct {
 	// Http service url like "http://host/src?a=1".
-	// Must be define.
+	// If it's not empty,it will be added to Upstream.
 	RequestUrl string `json:"requestUrl"`
+	// Upstream pool.
+	// RequestUrl and Upstream,at least one must be define.
+	Upstream []*UpstreamData `json:"upstream"`
+	// Load balance strategy,"roundRobin"(default),"weightedRoundRobin","leastConn","random2" or "hash".
+	Balance string `json:"balance"`
+	// Hash key of "hash" strategy,"ip","header:Name" or "cookie:Name".
+	HashKey string `json:"hashKey"`
+	// Upstream active and passive health check.
+	HealthCheck *HealthCheckData `json:"healthCheck"`
+	// Retry policy when forward failed.
+	Retry *RetryData `json:"retry"`
+	// Responses when forward failed,key is error class,
+	// "connect","timeout","reset","tls","other" or "unavailable".
+	// Default status code is 504 for "timeout",503 for "unavailable",others are 502.
+	ErrorResponse map[string]*InterceptData `json:"errorResponse"`
+	// Response header which value is error class,default is "X-Gateway-Error".
+	ErrorHeader string `json:"errorHeader"`
+	// Upstream http transport of this forwarder.
+	Transport *TransportData `json:"transport"`
+	// Use named shared transport,instead of Transport.
+	TransportName string `json:"transportName"`
+	// Upstream TLS settings,replace "transport.tls".
+	TLS *TLSData `json:"tls"`
 	// Forward request timeout,millisecond.
 	RequestTimeout int `json:"requestTimeout"`
+	// Upgrade(WebSocket) connection idle timeout,millisecond,0 means no limit.
+	UpgradeIdleTimeout int `json:"upgradeIdleTimeout"`
+	// Flush response to client by this interval,millisecond.
+	// 0 means don't flush until buffer is full,negative value means flush after every write.
+	// "text/event-stream" and response without Content-Length are always flushed immediately.
+	FlushInterval int `json:"flushInterval"`
 	// Which heads will be forward.
 	// If it's empty,forward all headers.
 	RequestHeader []string `json:"requestHeader"`
 	// Addition heads add to forward request.
 	RequestAdditionHeader map[string]string `json:"requestAdditionHeader"`
+	// Client info headers add to forward request.
+	Forwarded *ForwardedData `json:"forwarded"`
 	// Addition heads add to forward response.
 	ResponseAdditionHeader map[string]string `json:"responseAdditionHeader"`
 }
 
 // Forward HTTP request.
 type DefaultForwarder struct {
-	// Foward url.
-	RequestUrl *url.URL
+	// Upstream pool,value is *UpstreamPool.
+	pool atomic.Value
+	// Upstream active health checker.
+	checker *healthChecker
+	// Retry policy,nil means don't retry.
+	retry *retryPolicy
+	// Responses when forward failed,key is error class.
+	ErrorResponse map[string]*InterceptData
+	// Response header which value is error class.
+	ErrorHeader string
+	// Upstream http transport.
+	transport switchTransport
+	// Transport created by this forwarder,not shared.
+	ownTransport *http.Transport
+	// Data of ownTransport.
+	transportData TransportData
+	// Forward http client.
+	client *http.Client
+	// Forward http client of upgrade request,no timeout.
+	upgradeClient *http.Client
 	// Forward request timeout,millisecond.
 	RequestTimeout time.Duration
+	// Upgrade connection idle timeout,millisecond.
+	UpgradeIdleTimeout time.Duration
+	// Response flush interval,millisecond.
+	FlushInterval time.Duration
 	// Which heads will be forward.
 	// If it's empty,forward all headers.
 	RequestHeader map[string]int
 	// Addition heads add to forward request.
 	RequestAdditionHeader map[string]string
+	// Client info headers.
+	forwarded *forwardedHeader
 	// Addition heads add to forward response.
 	ResponseAdditionHeader map[string]string
 }
 
 func (h *DefaultForwarder) Handle(c *Context) bool {
+	pool := h.Upstream()
+	retry := h.retry
+	if retry != nil {
+		retry.budget.Deposit()
+		if _, ok := retry.method[c.Req.Method]; !ok || c.Req.ContentLength > int64(retry.maxBodySize) {
+			retry = nil
+		}
+	}
+	// Buffer request body for replay.
+	var body *replayBody
+	if retry != nil {
+		var err error
+		body, err = newReplayBody(c.Req.Body, retry.maxBodySize)
+		if err != nil {
+			// Client error,not an upstream error class.
+			logError(err)
+			if c.Req.Context().Err() == nil {
+				http.Error(c.Res, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			}
+			return false
+		}
+		if !body.Replayable() {
+			retry = nil
+		}
+	}
+	client := h.client
+	upgrade := upgradeType(c.Req.Header)
+	if upgrade != "" {
+		client = h.upgradeClient
+	}
+	var tried []*Upstream
+	for attempt := 1; ; attempt++ {
+		// Try a different upstream.
+		upstream := pool.Next(c, tried...)
+		if upstream == nil {
+			h.writeError(c, ForwardErrorUnavailable)
+			return false
+		}
+		tried = append(tried, upstream)
+		request := h.newRequest(c, upstream)
+		if body != nil {
+			request.Body = body.Body()
+		}
+		// Do request.
+		upstream.acquire()
+		response, err := client.Do(request)
+		if err != nil {
+			upstream.release()
+			upstream.forwardResult(false, pool.HealthCheck)
+			if retry != nil && retry.Retry(attempt, err, 0) && retry.Backoff(c.Req.Context(), attempt) {
+				continue
+			}
+			logError(err)
+			h.writeError(c, ForwardErrorClass(err))
+			return false
+		}
+		upstream.forwardResult(response.StatusCode < http.StatusInternalServerError, pool.HealthCheck)
+		// If backoff is canceled,write this response.
+		if retry != nil && retry.Retry(attempt, nil, response.StatusCode) && retry.Backoff(c.Req.Context(), attempt) {
+			response.Body.Close()
+			upstream.release()
+			continue
+		}
+		// Upstream switched protocol.
+		if upgrade != "" && response.StatusCode == http.StatusSwitchingProtocols {
+			ok := h.writeUpgrade(c, response)
+			upstream.release()
+			return ok
+		}
+		response = c.handleResponse(response)
+		h.writeResponse(c, response)
+		response.Body.Close()
+		upstream.release()
+		return true
+	}
+}
+
+// Create forward request.
+func (h *DefaultForwarder) newRequest(c *Context, upstream *Upstream) *http.Request {
 	// Init forward http.Request.
-	var request http.Request
+	request := new(http.Request)
 	request.Method = c.Req.Method
 	request.URL = new(url.URL)
-	*request.URL = *h.RequestUrl
+	*request.URL = *upstream.Url
 	request.URL.Path = c.Req.URL.Path[len(c.Path):]
 	request.URL.RawQuery = c.Req.URL.RawQuery
 	request.URL.RawFragment = c.Req.URL.RawFragment
@@ -130,8 +323,8 @@ func (h *DefaultForwarder) Handle(c *Context) bool {
 	request.Header = make(http.Header)
 	if len(h.RequestHeader) < 1 {
 		// Forward all headers.
-		for k := range c.Req.Header {
-			request.Header.Set(k, c.Req.Header.Get(k))
+		for k, v := range c.Req.Header {
+			request.Header[k] = append([]string(nil), v...)
 		}
 	} else {
 		// Forward specified headers.
@@ -142,21 +335,46 @@ func (h *DefaultForwarder) Handle(c *Context) bool {
 			}
 		}
 	}
+	removeHopHeaders(request.Header)
+	// Tell upstream that client accepts trailers.
+	if te := c.Req.Header.Get("Te"); strings.Contains(strings.ToLower(te), "trailers") {
+		request.Header.Set("Te", "trailers")
+	}
+	// Client info headers.
+	h.forwarded.Apply(c, request.Header)
+	// Upgrade headers.
+	if upgradeType(c.Req.Header) != "" {
+		request.Header.Set("Connection", "Upgrade")
+		request.Header.Set("Upgrade", c.Req.Header.Get("Upgrade"))
+	}
 	// Addition headers
 	for k, v := range h.RequestAdditionHeader {
 		request.Header.Set(k, v)
 	}
 	request.Body = c.Req.Body
-	// Do request.
-	client := &http.Client{Timeout: h.RequestTimeout}
-	response, err := client.Do(&request)
-	if err != nil {
-		fmt.Println(err)
-		return false
-	}
+	// Request trailers are filled after body was read.
+	request.Trailer = c.Req.Trailer
+	return request.WithContext(c.Req.Context())
+}
+
+// Upstream response headers which are added to headers set by handlers.
+var mergedResponseHeader = map[string]int{
+	"Vary":       1,
+	"Set-Cookie": 1,
+}
+
+// Write upstream response to client.
+func (h *DefaultForwarder) writeResponse(c *Context, response *http.Response) {
 	// Response headers.
+	// Headers set by handlers(like CORS) win over upstream headers,except merged headers.
+	removeHopHeaders(response.Header)
 	header := c.Res.Header()
 	for k, v := range response.Header {
+		if _, ok := header[k]; ok {
+			if _, merge := mergedResponseHeader[k]; !merge {
+				continue
+			}
+		}
 		for _, s := range v {
 			header.Add(k, s)
 		}
@@ -165,9 +383,32 @@ func (h *DefaultForwarder) Handle(c *Context) bool {
 	for k, v := range h.ResponseAdditionHeader {
 		header.Add(k, v)
 	}
+	// Announce trailers.
+	var trailer map[string]int
+	if len(response.Trailer) > 0 {
+		trailer = make(map[string]int)
+		keys := make([]string, 0, len(response.Trailer))
+		for k := range response.Trailer {
+			trailer[k] = 1
+			keys = append(keys, k)
+		}
+		header.Add("Trailer", strings.Join(keys, ", "))
+	}
 	c.Res.WriteHeader(response.StatusCode)
-	io.Copy(c.Res, response.Body)
-	return true
+	err := copyResponse(c.Res, response.Body, h.flushInterval(response))
+	if err != nil {
+		logError(err)
+		return
+	}
+	// Trailers are available after body was read.
+	for k, v := range response.Trailer {
+		if _, ok := trailer[k]; !ok {
+			k = http.TrailerPrefix + k
+		}
+		for _, s := range v {
+			header.Add(k, s)
+		}
+	}
 }
 
 // Arg data is *DefaultForwarderData type.
@@ -179,16 +420,46 @@ func (h *DefaultForwarder) Update(data interface{}) error {
 	if !ok {
 		return errors.New(`data must be "*DefaultForwarderData" type`)
 	}
-	// requestUrl
-	requestUrl, err := url.Parse(d.RequestUrl)
+	// transport and transportName
+	err := h.updateTransport(d)
 	if err != nil {
-		return fmt.Errorf(`"requestUrl" %s`, err.Error())
+		return err
+	}
+	// upstream,balance and healthCheck
+	err = h.updateUpstream(d)
+	if err != nil {
+		return err
+	}
+	// errorResponse
+	if d.ErrorResponse != nil || h.ErrorResponse == nil {
+		errorResponse, err := newForwardErrorResponse(d.ErrorResponse)
+		if err != nil {
+			return err
+		}
+		h.ErrorResponse = errorResponse
+	}
+	// errorHeader
+	if d.ErrorHeader != "" {
+		h.ErrorHeader = d.ErrorHeader
+	} else if h.ErrorHeader == "" {
+		h.ErrorHeader = "X-Gateway-Error"
+	}
+	// retry
+	if d.Retry != nil {
+		h.retry = newRetryPolicy(d.Retry)
 	}
-	h.RequestUrl = requestUrl
 	// requestTimeout
 	if d.RequestTimeout >= 0 {
 		h.RequestTimeout = time.Duration(d.RequestTimeout) * time.Millisecond
 	}
+	h.client = &http.Client{Transport: &h.transport, Timeout: h.RequestTimeout}
+	h.upgradeClient = &http.Client{Transport: &h.transport}
+	// upgradeIdleTimeout
+	if d.UpgradeIdleTimeout >= 0 {
+		h.UpgradeIdleTimeout = time.Duration(d.UpgradeIdleTimeout) * time.Millisecond
+	}
+	// flushInterval
+	h.FlushInterval = time.Duration(d.FlushInterval) * time.Millisecond
 	// requestHeader
 	if len(d.RequestHeader) > 0 {
 		h.RequestHeader = make(map[string]int)
@@ -196,6 +467,18 @@ func (h *DefaultForwarder) Update(data interface{}) error {
 			h.RequestHeader[s] = 1
 		}
 	}
+	// forwarded
+	if d.Forwarded != nil || h.forwarded == nil {
+		data := d.Forwarded
+		if data == nil {
+			data = new(ForwardedData)
+		}
+		forwarded, err := newForwardedHeader(data)
+		if err != nil {
+			return err
+		}
+		h.forwarded = forwarded
+	}
 	// requestAdditionHeader
 	if len(d.RequestAdditionHeader) > 0 {
 		h.RequestAdditionHeader = make(map[string]string)
@@ -213,7 +496,107 @@ func (h *DefaultForwarder) Update(data interface{}) error {
 	return nil
 }
 
-func (h *DefaultForwarder) Release() {}
+// Update upstream pool and restart health checker.
+func (h *DefaultForwarder) updateUpstream(d *NewDefaultForwarderData) error {
+	pool := new(UpstreamPool)
+	if old := h.Upstream(); old != nil {
+		*pool = *old
+	}
+	// balance
+	if d.Balance != "" || pool.Balancer == nil {
+		balancer, err := NewBalancer(d.Balance, d.HashKey)
+		if err != nil {
+			return err
+		}
+		pool.Balancer = balancer
+	}
+	// requestUrl and upstream
+	data := d.Upstream
+	if d.RequestUrl != "" {
+		data = append([]*UpstreamData{{Url: d.RequestUrl}}, data...)
+	}
+	if len(data) > 0 {
+		upstream, err := newUpstreams(data)
+		if err != nil {
+			return err
+		}
+		pool.Upstream = upstream
+	}
+	// healthCheck
+	if d.HealthCheck != nil {
+		pool.HealthCheck = new(HealthCheckData)
+		*pool.HealthCheck = *d.HealthCheck
+		pool.HealthCheck.Check()
+	}
+	if pool.Upstream == nil {
+		return nil
+	}
+	h.pool.Store(pool)
+	// Restart active health checker.
+	if len(data) > 0 || d.HealthCheck != nil {
+		if h.checker != nil {
+			h.checker.Stop()
+			h.checker = nil
+		}
+		if pool.HealthCheck != nil && pool.HealthCheck.Path != "" {
+			h.checker = newHealthChecker(pool.Upstream, pool.HealthCheck, &h.transport)
+		}
+	}
+	return nil
+}
+
+// Update forward transport.
+func (h *DefaultForwarder) updateTransport(d *NewDefaultForwarderData) error {
+	var ownTransport *http.Transport
+	if d.TransportName != "" {
+		if d.Transport != nil || d.TLS != nil {
+			return errors.New(`"transportName" can't be used with "transport" or "tls"`)
+		}
+		transport, err := SharedTransport(d.TransportName)
+		if err != nil {
+			return err
+		}
+		h.transport.Store(transport)
+	} else if d.Transport != nil || d.TLS != nil || h.transport.Load() == nil {
+		data := h.transportData
+		if d.Transport != nil {
+			data = *d.Transport
+		}
+		if d.TLS != nil {
+			data.TLS = d.TLS
+		}
+		var err error
+		ownTransport, err = NewTransport(&data)
+		if err != nil {
+			return err
+		}
+		h.transportData = data
+		h.transport.Store(ownTransport)
+	} else {
+		return nil
+	}
+	if h.ownTransport != nil {
+		h.ownTransport.CloseIdleConnections()
+	}
+	h.ownTransport = ownTransport
+	return nil
+}
+
+func (h *DefaultForwarder) Release() {
+	if h.checker != nil {
+		h.checker.Stop()
+		h.checker = nil
+	}
+	if h.ownTransport != nil {
+		h.ownTransport.CloseIdleConnections()
+	}
+}
+
+// Return upstream pool.
+func (h *DefaultForwarder) Upstream() *UpstreamPool {
+	pool, _ := h.pool.Load().(*UpstreamPool)
+	return pool
+}
 
 // Create DefaultForwarder function.
 func NewDefaultForwarder(data interface{}) (Handler, error) {
@@ -242,8 +625,8 @@ func NewDefaultForwarder(data interface{}) (Handler, error) {
 	if err != nil {
 		return nil, err
 	}
-	if h.RequestUrl == nil {
-		return nil, errors.New(`"requestUrl" must be defined`)
+	if h.Upstream() == nil {
+		return nil, errors.New(`"requestUrl" or "upstream" must be defined`)
 	}
 	return h, nil
 }
@@ -327,8 +710,8 @@ func (d *InterceptData) Check(code int) {
 }
 
 func (d *InterceptData) WriteToResponse(res http.ResponseWriter) error {
+	res.Header().Set("Content-Type", d.ContentType)
 	res.WriteHeader(d.StatusCode)
-	res.Header().Add("Content-Type", d.ContentType)
 	io.WriteString(res, d.Message)
 	return nil
 }
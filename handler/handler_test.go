@@ -41,6 +41,34 @@ func (r *testResponse) Reset() {
 	r.body.Reset()
 }
 
+// Create a request,header can be nil.
+func testRequest(method, target string, header http.Header) *http.Request {
+	req, _ := http.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return req
+}
+
+// Create a GET request with bearer token,no "Authorization" if token is empty.
+func testBearerRequest(token string) *http.Request {
+	req := testRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// Handle request of route,return context and response.
+func testHandle(h Handler, route string, req *http.Request) (*Context, *testResponse) {
+	c := new(Context)
+	res := new(testResponse)
+	c.Reset(res, req)
+	c.Route = route
+	h.Handle(c)
+	return c, res
+}
+
 func Test_DefaultForwarder(t *testing.T) {
 	d := &NewDefaultForwarderData{
 		RequestUrl:             "http://127.0.0.1:3391",
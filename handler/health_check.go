@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upstream health check initial data.
+type HealthCheckData struct {
+	// Active check url path like "/health".
+	// If it's empty,don't do active check.
+	Path string `json:"path"`
+	// Expected response status code of active check,default is 200.
+	StatusCode int `json:"statusCode"`
+	// Active check interval,millisecond,default is 5000.
+	Interval int `json:"interval"`
+	// Active check request timeout,millisecond,default is 1000.
+	Timeout int `json:"timeout"`
+	// Consecutive active check failures to take upstream out of rotation,default is 3.
+	UnhealthyThreshold int `json:"unhealthyThreshold"`
+	// Consecutive active check successes to put upstream back to rotation,default is 2.
+	HealthyThreshold int `json:"healthyThreshold"`
+	// Consecutive forward failures(error or 5xx) to eject upstream.
+	// If it's 0,don't do passive check.
+	PassiveFailures int `json:"passiveFailures"`
+	// How long ejected upstream will be put back to rotation,millisecond,default is 30000.
+	EjectTime int `json:"ejectTime"`
+}
+
+// Set default values.
+func (d *HealthCheckData) Check() {
+	if d.StatusCode == 0 {
+		d.StatusCode = http.StatusOK
+	}
+	if d.Interval < 1 {
+		d.Interval = 5000
+	}
+	if d.Timeout < 1 {
+		d.Timeout = 1000
+	}
+	if d.UnhealthyThreshold < 1 {
+		d.UnhealthyThreshold = 3
+	}
+	if d.HealthyThreshold < 1 {
+		d.HealthyThreshold = 2
+	}
+	if d.EjectTime < 1 {
+		d.EjectTime = 30000
+	}
+}
+
+// Upstream status,use for management api.
+type UpstreamStatus struct {
+	Url    string `json:"url"`
+	Weight int    `json:"weight"`
+	// Active check result.
+	Healthy bool `json:"healthy"`
+	// Passive check result.
+	Ejected bool `json:"ejected"`
+	// Active connections.
+	Conn int64 `json:"conn"`
+}
+
+// Upstream health state.
+type upstreamHealth struct {
+	// Ejected by passive check until this time,unix nano.
+	ejectUntil int64
+	// 1 means active check failed.
+	unhealthy int32
+	// Consecutive forward failures.
+	passiveFailures int32
+	// Consecutive active check successes and failures,only used in check routine.
+	activeSuccesses int
+	activeFailures  int
+}
+
+// Return false if upstream is unhealthy or ejected.
+func (u *Upstream) Available() bool {
+	return atomic.LoadInt32(&u.unhealthy) == 0 &&
+		time.Now().UnixNano() >= atomic.LoadInt64(&u.ejectUntil)
+}
+
+// Return upstream status.
+func (u *Upstream) Status() *UpstreamStatus {
+	return &UpstreamStatus{
+		Url:     u.Url.String(),
+		Weight:  u.Weight,
+		Healthy: atomic.LoadInt32(&u.unhealthy) == 0,
+		Ejected: time.Now().UnixNano() < atomic.LoadInt64(&u.ejectUntil),
+		Conn:    u.Conn(),
+	}
+}
+
+// Passive check,record forward result.
+func (u *Upstream) forwardResult(ok bool, d *HealthCheckData) {
+	if ok {
+		if atomic.LoadInt32(&u.passiveFailures) != 0 {
+			atomic.StoreInt32(&u.passiveFailures, 0)
+		}
+		return
+	}
+	if d == nil || d.PassiveFailures < 1 {
+		return
+	}
+	if atomic.AddInt32(&u.passiveFailures, 1) >= int32(d.PassiveFailures) {
+		atomic.StoreInt32(&u.passiveFailures, 0)
+		atomic.StoreInt64(&u.ejectUntil, time.Now().Add(time.Duration(d.EjectTime)*time.Millisecond).UnixNano())
+	}
+}
+
+// Active check,record probe result.
+func (u *Upstream) probeResult(ok bool, d *HealthCheckData) {
+	if ok {
+		u.activeFailures = 0
+		u.activeSuccesses++
+		if u.activeSuccesses >= d.HealthyThreshold {
+			atomic.StoreInt32(&u.unhealthy, 0)
+		}
+		return
+	}
+	u.activeSuccesses = 0
+	u.activeFailures++
+	if u.activeFailures >= d.UnhealthyThreshold {
+		atomic.StoreInt32(&u.unhealthy, 1)
+	}
+}
+
+// Probe upstreams periodically.
+type healthChecker struct {
+	data     *HealthCheckData
+	upstream []*Upstream
+	client   http.Client
+	quit     chan struct{}
+	wait     sync.WaitGroup
+}
+
+// Create and start a health checker.
+func newHealthChecker(upstream []*Upstream, data *HealthCheckData, transport http.RoundTripper) *healthChecker {
+	c := new(healthChecker)
+	c.data = data
+	c.upstream = upstream
+	c.client.Transport = transport
+	c.client.Timeout = time.Duration(data.Timeout) * time.Millisecond
+	c.quit = make(chan struct{})
+	c.wait.Add(1)
+	go c.run()
+	return c
+}
+
+// Stop check routine and wait for it exit.
+func (c *healthChecker) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+}
+
+func (c *healthChecker) run() {
+	defer c.wait.Done()
+	ticker := time.NewTicker(time.Duration(c.data.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		c.check()
+		select {
+		case <-ticker.C:
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+func (c *healthChecker) check() {
+	var wait sync.WaitGroup
+	for _, u := range c.upstream {
+		wait.Add(1)
+		go func(u *Upstream) {
+			defer wait.Done()
+			u.probeResult(c.probe(u), c.data)
+		}(u)
+	}
+	wait.Wait()
+}
+
+// Return true if upstream response expected status code.
+func (c *healthChecker) probe(u *Upstream) bool {
+	probeUrl := &url.URL{
+		Scheme: u.Url.Scheme,
+		User:   u.Url.User,
+		Host:   u.Url.Host,
+		Path:   c.data.Path,
+	}
+	request, err := http.NewRequest(http.MethodGet, probeUrl.String(), nil)
+	if err != nil {
+		return false
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
+	return response.StatusCode == c.data.StatusCode
+}
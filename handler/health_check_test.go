@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_PassiveHealthCheck(t *testing.T) {
+	pool := testUpstreamPool(t, BalanceRoundRobin, "", 1, 1)
+	pool.HealthCheck = &HealthCheckData{PassiveFailures: 2, EjectTime: 50}
+	pool.HealthCheck.Check()
+	u := pool.Upstream[0]
+	u.forwardResult(false, pool.HealthCheck)
+	u.forwardResult(true, pool.HealthCheck)
+	u.forwardResult(false, pool.HealthCheck)
+	if !u.Available() {
+		t.FailNow()
+	}
+	u.forwardResult(false, pool.HealthCheck)
+	if u.Available() || !u.Status().Ejected {
+		t.FailNow()
+	}
+	count := testUpstreamCount(pool, new(Context), 10)
+	if count[pool.Upstream[1]] != 10 {
+		t.FailNow()
+	}
+	// Re-admit.
+	time.Sleep(60 * time.Millisecond)
+	if !u.Available() {
+		t.FailNow()
+	}
+	// All unavailable.
+	pool.Upstream[0].forwardResult(false, pool.HealthCheck)
+	pool.Upstream[0].forwardResult(false, pool.HealthCheck)
+	pool.Upstream[1].forwardResult(false, pool.HealthCheck)
+	pool.Upstream[1].forwardResult(false, pool.HealthCheck)
+	if pool.Next(new(Context)) != nil {
+		t.FailNow()
+	}
+}
+
+func Test_ActiveHealthCheck(t *testing.T) {
+	var status int32 = http.StatusOK
+	ser := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ser.Close()
+
+	h, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		RequestUrl: ser.URL,
+		HealthCheck: &HealthCheckData{
+			Path:               "/health",
+			Interval:           10,
+			UnhealthyThreshold: 2,
+			HealthyThreshold:   2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	u := h.(*DefaultForwarder).Upstream().Upstream[0]
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+	time.Sleep(50 * time.Millisecond)
+	if u.Available() || u.Status().Healthy {
+		t.FailNow()
+	}
+	atomic.StoreInt32(&status, http.StatusOK)
+	time.Sleep(50 * time.Millisecond)
+	if !u.Available() {
+		t.FailNow()
+	}
+}
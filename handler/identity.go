@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Authenticated identity,authentication handlers save it in Context.Data.
+// Authorization handlers and forwarders use it.
+type Identity struct {
+	// Subject,like user id.
+	Subject string `json:"subject"`
+	// Roles of subject.
+	Roles []string `json:"roles"`
+	// OAuth2 scopes.
+	Scopes []string `json:"scopes"`
+	// All claims.
+	Claims map[string]interface{} `json:"claims"`
+}
+
+// Create Identity from claims.
+// "sub" is subject,"roles" is roles,"scope"(space separated) or "scp" is scopes.
+func NewIdentity(claims map[string]interface{}) *Identity {
+	id := new(Identity)
+	if claims == nil {
+		claims = make(map[string]interface{})
+	}
+	id.Claims = claims
+	id.Subject = claimString(claims["sub"])
+	id.Roles = claimStrings(claims["roles"])
+	if s, ok := claims["scope"].(string); ok {
+		id.Scopes = strings.Fields(s)
+	} else {
+		id.Scopes = claimStrings(claims["scp"])
+	}
+	return id
+}
+
+// Return Identity in Context.Data,or nil.
+func (c *Context) Identity() *Identity {
+	id, _ := c.Data.(*Identity)
+	return id
+}
+
+// Set claims to request headers,key of mapping is claim name,value is header name,
+// like {"sub": "X-User-Id","roles": "X-User-Roles"}.
+// Array claim is joined by ",".
+// Headers are always removed first,so client can't fake them.
+func (id *Identity) SetHeader(header http.Header, mapping map[string]string) {
+	removeIdentityHeader(header, mapping)
+	for k, v := range mapping {
+		value, ok := id.Claims[k]
+		if !ok {
+			continue
+		}
+		var s string
+		switch value.(type) {
+		case []interface{}, []string:
+			s = strings.Join(claimStrings(value), ",")
+		default:
+			s = claimString(value)
+		}
+		if s != "" {
+			header.Set(v, s)
+		}
+	}
+}
+
+// Remove headers of mapping,use when request is not authenticated.
+func removeIdentityHeader(header http.Header, mapping map[string]string) {
+	for _, v := range mapping {
+		header.Del(v)
+	}
+}
+
+// Convert claim value to string.
+func claimString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case float64:
+		// Not exponent format,like 1e+06.
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(s)
+	case json.Number:
+		return string(s)
+	default:
+		data, _ := json.Marshal(s)
+		return string(data)
+	}
+}
+
+// Convert claim value to string array.
+// String value is an array of one element.
+func claimStrings(v interface{}) []string {
+	switch a := v.(type) {
+	case nil:
+		return nil
+	case []string:
+		return a
+	case []interface{}:
+		s := make([]string, 0, len(a))
+		for _, e := range a {
+			s = append(s, claimString(e))
+		}
+		return s
+	default:
+		return []string{claimString(a)}
+	}
+}
@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// IntrospectionInterceptor register name.
+	introspectionInterceptorRegisterName = HandlerName(&IntrospectionInterceptor{})
+)
+
+func init() {
+	// Register IntrospectionInterceptor.
+	RegisterHandler(introspectionInterceptorRegisterName, NewIntrospectionInterceptor)
+}
+
+// Get IntrospectionInterceptor register name.
+func IntrospectionInterceptorRegisterName() string {
+	return introspectionInterceptorRegisterName
+}
+
+// A Interceptor that validates opaque bearer token by OAuth2 token introspection(RFC 7662).
+// Introspection response is saved in Context.Data as *Identity.
+type IntrospectionInterceptor struct {
+	// Response of missing or inactive token,default status code is 401.
+	InterceptData
+	// Response of insufficient scope,default status code is 403.
+	ForbiddenResponse InterceptData
+	// Introspection endpoint.
+	endpoint string
+	// Client credentials.
+	clientID     string
+	clientSecret string
+	// Introspection http client.
+	client *http.Client
+	// Transport of client.
+	transport *http.Transport
+	// Required scopes of all routes.
+	scope []string
+	// Required scopes of route,key is route name.
+	routeScope map[string][]string
+	// Introspection result cache.
+	cache *introspectionCache
+	// Claims forward to upstream,key is claim name,value is header name.
+	ClaimHeader map[string]string
+}
+
+func (h *IntrospectionInterceptor) Release() {
+	if h.transport != nil {
+		h.transport.CloseIdleConnections()
+	}
+}
+
+func (h *IntrospectionInterceptor) Handle(c *Context) bool {
+	removeIdentityHeader(c.Req.Header, h.ClaimHeader)
+	const bearerTokenPrefix = "Bearer "
+	str := c.Req.Header.Get("Authorization")
+	if !strings.HasPrefix(str, bearerTokenPrefix) {
+		h.unauthorized(c)
+		return false
+	}
+	claims, err := h.Introspect(str[len(bearerTokenPrefix):])
+	if err != nil {
+		logError(err)
+	}
+	if claims == nil {
+		h.unauthorized(c)
+		return false
+	}
+	id := NewIdentity(claims)
+	// Scopes.
+	if !introspectionHasScope(id.Scopes, h.scope) || !introspectionHasScope(id.Scopes, h.routeScope[c.Route]) {
+		c.Res.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		h.ForbiddenResponse.WriteToResponse(c.Res)
+		return false
+	}
+	id.SetHeader(c.Req.Header, h.ClaimHeader)
+	c.Data = id
+	return true
+}
+
+func (h *IntrospectionInterceptor) unauthorized(c *Context) {
+	c.Res.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	h.InterceptData.WriteToResponse(c.Res)
+}
+
+// Return true if scopes contains all required scopes.
+func introspectionHasScope(scopes, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, s := range scopes {
+			if s == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Return claims of active token,or nil if token is inactive.
+func (h *IntrospectionInterceptor) Introspect(token string) (map[string]interface{}, error) {
+	key := sha256.Sum256([]byte(token))
+	claims, ok := h.cache.Get(key)
+	if ok {
+		return claims, nil
+	}
+	// Request endpoint.
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+	req, err := http.NewRequest(http.MethodPost, h.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if h.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(h.clientID), url.QueryEscape(h.clientSecret))
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(`introspection endpoint response %d`, res.StatusCode)
+	}
+	err = json.NewDecoder(res.Body).Decode(&claims)
+	if err != nil {
+		return nil, err
+	}
+	if active, _ := claims["active"].(bool); !active {
+		claims = nil
+	}
+	h.cache.Set(key, claims)
+	return claims, nil
+}
+
+type IntrospectionInterceptorData struct {
+	InterceptData
+	// Response of insufficient scope.
+	ForbiddenResponse InterceptData `json:"forbiddenResponse"`
+	// Introspection endpoint url.
+	Endpoint string `json:"endpoint"`
+	// Client id and secret,use http basic auth to request endpoint.
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+	// Request endpoint timeout,millisecond,default is 5000.
+	Timeout int `json:"timeout"`
+	// Transport of endpoint,like TLS settings.
+	Transport *TransportData `json:"transport"`
+	// Active token cache ttl,millisecond,default is 60000,no longer than "exp" of token.
+	CacheTTL int `json:"cacheTTL"`
+	// Inactive token cache ttl,millisecond,default is 5000.
+	NegativeCacheTTL int `json:"negativeCacheTTL"`
+	// Max cached tokens,default is 10000.
+	CacheSize int `json:"cacheSize"`
+	// Required scopes of all routes.
+	Scope []string `json:"scope"`
+	// Required scopes of route,key is route name.
+	RouteScope map[string][]string `json:"routeScope"`
+	// Claims forward to upstream,key is claim name,value is header name,
+	// like {"sub": "X-User-Id","scope": "X-User-Scope"}.
+	ClaimHeader map[string]string `json:"claimHeader"`
+}
+
+func (h *IntrospectionInterceptor) Update(data interface{}) error {
+	d, ok := data.(*IntrospectionInterceptorData)
+	if !ok {
+		return errors.New(`data must be "*IntrospectionInterceptorData" type`)
+	}
+	// endpoint
+	_, err := url.ParseRequestURI(d.Endpoint)
+	if err != nil {
+		return fmt.Errorf(`"endpoint" %s`, err.Error())
+	}
+	// transport
+	transport, err := NewTransport(d.Transport)
+	if err != nil {
+		return err
+	}
+	timeout := d.Timeout
+	if timeout < 1 {
+		timeout = 5000
+	}
+	// cache
+	ttl := d.CacheTTL
+	if ttl < 1 {
+		ttl = 60000
+	}
+	negativeTTL := d.NegativeCacheTTL
+	if negativeTTL < 1 {
+		negativeTTL = 5000
+	}
+	size := d.CacheSize
+	if size < 1 {
+		size = 10000
+	}
+	if h.transport != nil {
+		h.transport.CloseIdleConnections()
+	}
+	h.transport = transport
+	h.client = &http.Client{Transport: transport, Timeout: time.Duration(timeout) * time.Millisecond}
+	h.endpoint = d.Endpoint
+	h.clientID = d.ClientID
+	h.clientSecret = d.ClientSecret
+	h.cache = newIntrospectionCache(time.Duration(ttl)*time.Millisecond, time.Duration(negativeTTL)*time.Millisecond, size)
+	h.InterceptData = d.InterceptData
+	h.InterceptData.Check(http.StatusUnauthorized)
+	h.ForbiddenResponse = d.ForbiddenResponse
+	h.ForbiddenResponse.Check(http.StatusForbidden)
+	h.scope = d.Scope
+	h.routeScope = d.RouteScope
+	h.ClaimHeader = d.ClaimHeader
+	return nil
+}
+
+// Create a new IntrospectionInterceptor
+func NewIntrospectionInterceptor(data interface{}) (Handler, error) {
+	var d *IntrospectionInterceptorData
+	switch v := data.(type) {
+	case *IntrospectionInterceptorData:
+		d = v
+	case string:
+		d = new(IntrospectionInterceptorData)
+		err := json.Unmarshal([]byte(v), d)
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		d = new(IntrospectionInterceptorData)
+		err := Map2Struct(v, d)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
+	}
+	h := new(IntrospectionInterceptor)
+	err := h.Update(d)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Bounded cache of introspection result,key is sha256 of token.
+type introspectionCache struct {
+	sync.Mutex
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+	entry       map[[sha256.Size]byte]*introspectionCacheEntry
+}
+
+type introspectionCacheEntry struct {
+	// Nil means inactive.
+	claims map[string]interface{}
+	expire time.Time
+}
+
+func newIntrospectionCache(ttl, negativeTTL time.Duration, size int) *introspectionCache {
+	return &introspectionCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		size:        size,
+		entry:       make(map[[sha256.Size]byte]*introspectionCacheEntry),
+	}
+}
+
+// Return cached claims and true if it's not expired.
+func (c *introspectionCache) Get(key [sha256.Size]byte) (map[string]interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entry[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expire) {
+		delete(c.entry, key)
+		return nil, false
+	}
+	return e.claims, true
+}
+
+func (c *introspectionCache) Set(key [sha256.Size]byte, claims map[string]interface{}) {
+	now := time.Now()
+	e := &introspectionCacheEntry{claims: claims, expire: now.Add(c.negativeTTL)}
+	if claims != nil {
+		e.expire = now.Add(c.ttl)
+		// No longer than token expiration.
+		if exp, ok := claims["exp"].(float64); ok && jwtTime(exp).Before(e.expire) {
+			e.expire = jwtTime(exp)
+		}
+	}
+	c.Lock()
+	defer c.Unlock()
+	if len(c.entry) >= c.size {
+		// Remove expired entries first,than random entries.
+		for k, v := range c.entry {
+			if now.After(v.expire) {
+				delete(c.entry, k)
+			}
+		}
+		for k := range c.entry {
+			if len(c.entry) < c.size {
+				break
+			}
+			delete(c.entry, k)
+		}
+	}
+	c.entry[key] = e
+}
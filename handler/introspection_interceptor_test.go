@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_IntrospectionInterceptor(t *testing.T) {
+	var calls int32
+	ser := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "gateway" || secret != "secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		result := map[string]interface{}{"active": false}
+		switch r.PostFormValue("token") {
+		case "token1":
+			result = map[string]interface{}{
+				"active": true,
+				"sub":    "1001",
+				"scope":  "orders:read orders:write",
+				"exp":    time.Now().Add(time.Hour).Unix(),
+			}
+		case "token2":
+			result = map[string]interface{}{
+				"active": true,
+				"sub":    "1002",
+				"scope":  "orders:read",
+				"exp":    time.Now().Add(time.Hour).Unix(),
+			}
+		}
+		json.NewEncoder(rw).Encode(result)
+	}))
+	defer ser.Close()
+	h, err := NewHandler(IntrospectionInterceptorRegisterName(), &IntrospectionInterceptorData{
+		Endpoint:     ser.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		Scope:        []string{"orders:read"},
+		RouteScope:   map[string][]string{"order-write": {"orders:write"}},
+		ClaimHeader:  map[string]string{"sub": "X-User-Id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	// Active token,cached.
+	for i := 0; i < 2; i++ {
+		c, res := testHandle(h, "order-write", testBearerRequest("token1"))
+		if res.statusCode != 0 || c.Identity().Subject != "1001" || c.Req.Header.Get("X-User-Id") != "1001" {
+			t.FailNow()
+		}
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.FailNow()
+	}
+	// Insufficient scope.
+	_, res := testHandle(h, "order-write", testBearerRequest("token2"))
+	if res.statusCode != http.StatusForbidden {
+		t.FailNow()
+	}
+	_, res = testHandle(h, "order-read", testBearerRequest("token2"))
+	if res.statusCode != 0 {
+		t.FailNow()
+	}
+	// Inactive token,negative cached.
+	for i := 0; i < 2; i++ {
+		_, res = testHandle(h, "order-read", testBearerRequest("token3"))
+		if res.statusCode != http.StatusUnauthorized {
+			t.FailNow()
+		}
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.FailNow()
+	}
+	_, res = testHandle(h, "order-read", testBearerRequest(""))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	// Bad client credentials are not cached.
+	err = h.Update(&IntrospectionInterceptorData{Endpoint: ser.URL, ClientID: "gateway"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, res = testHandle(h, "", testBearerRequest("token1"))
+		if res.statusCode != http.StatusUnauthorized {
+			t.FailNow()
+		}
+	}
+	if atomic.LoadInt32(&calls) != 5 {
+		t.FailNow()
+	}
+}
+
+func Test_IntrospectionCache(t *testing.T) {
+	c := newIntrospectionCache(time.Hour, time.Hour, 2)
+	c.Set([32]byte{1}, map[string]interface{}{"exp": float64(time.Now().Add(-time.Second).Unix())})
+	c.Set([32]byte{2}, nil)
+	// Expired by "exp".
+	_, ok := c.Get([32]byte{1})
+	if ok {
+		t.FailNow()
+	}
+	// Bounded.
+	c.Set([32]byte{3}, nil)
+	c.Set([32]byte{4}, nil)
+	if len(c.entry) > 2 {
+		t.FailNow()
+	}
+}
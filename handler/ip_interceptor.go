@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/qq51529210/redis"
 )
@@ -16,6 +20,12 @@ var (
 	ipInterceptorRegisterName = HandlerName(&IPInterceptor{})
 )
 
+// IPInterceptor modes.
+const (
+	IPInterceptorDeny  = "deny"
+	IPInterceptorAllow = "allow"
+)
+
 func init() {
 	// Register IPInterceptor.
 	RegisterHandler(ipInterceptorRegisterName, NewIPInterceptor)
@@ -26,38 +36,143 @@ func IPInterceptorRegisterName() string {
 	return ipInterceptorRegisterName
 }
 
-// Use for intercept request by ip address.
-// Request's ip in redis will be intercepted.
+// Use for intercept request by client ip address.
+// In "deny" mode,request in deny list and not in allow list will be intercepted.
+// In "allow" mode,request not in allow list or in deny list will be intercepted.
+// Ip in redis is added to the list of mode.
 type IPInterceptor struct {
 	InterceptData
+	// "deny" or "allow".
+	mode string
+	// Lists from configure.
+	allow *ipTree
+	deny  *ipTree
+	// Only intercept these routes,empty means all.
+	route map[string]int
 	// Redis client
 	redis *redis.Client
+	// Redis set name.
+	redisSet string
+	// Synced from redis set,value is *ipTree.
+	redisTree atomic.Value
+	// Redis set sync routine.
+	syncer *ipSyncer
+	// Local cache of redis query.
+	cache *ipCache
 }
 
 func (h *IPInterceptor) Release() {
+	if h.syncer != nil {
+		h.syncer.Stop()
+		h.syncer = nil
+	}
 	if h.redis != nil {
 		h.redis.Close()
 	}
 }
 
 func (h *IPInterceptor) Handle(c *Context) bool {
-	// Split ip address and port.
-	i := strings.IndexByte(c.Req.RemoteAddr, ':')
-	if i < 1 {
-		return false
+	if len(h.route) > 0 {
+		if _, ok := h.route[c.Route]; !ok {
+			return true
+		}
 	}
-	// Redis
-	value, err := h.redis.Cmd("GET", c.Req.RemoteAddr[:i])
-	if err != nil || value != nil {
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil || h.intercept(ip) {
 		h.InterceptData.WriteToResponse(c.Res)
 		return false
 	}
 	return true
 }
 
+// Return true if ip should be intercepted.
+func (h *IPInterceptor) intercept(ip net.IP) bool {
+	listed, err := h.redisContains(ip)
+	if err != nil {
+		logError(err)
+		return true
+	}
+	if h.mode == IPInterceptorAllow {
+		return !(listed || h.allow.Contains(ip)) || h.deny.Contains(ip)
+	}
+	return (listed || h.deny.Contains(ip)) && !h.allow.Contains(ip)
+}
+
+// Return true if ip is in redis.
+func (h *IPInterceptor) redisContains(ip net.IP) (bool, error) {
+	if h.redis == nil {
+		return false, nil
+	}
+	// Synced redis set.
+	if h.redisSet != "" {
+		tree, _ := h.redisTree.Load().(*ipTree)
+		return tree.Contains(ip), nil
+	}
+	// Query ip key.
+	key := ip.String()
+	found, ok := h.cache.Get(key)
+	if ok {
+		return found, nil
+	}
+	value, err := h.redis.Cmd("GET", key)
+	if err != nil {
+		return false, err
+	}
+	h.cache.Set(key, value != nil)
+	return value != nil, nil
+}
+
+// Load redis set into redisTree.
+func (h *IPInterceptor) syncRedisSet() {
+	value, err := h.redis.Cmd("SMEMBERS", h.redisSet)
+	if err != nil {
+		logError(err)
+		return
+	}
+	members, ok := value.([]interface{})
+	if !ok && value != nil {
+		logError(fmt.Errorf("invalid redis reply type %s", reflect.TypeOf(value)))
+		return
+	}
+	tree := new(ipTree)
+	for _, m := range members {
+		var s string
+		switch v := m.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		default:
+			continue
+		}
+		err = tree.Add(s)
+		if err != nil {
+			logError(err)
+		}
+	}
+	h.redisTree.Store(tree)
+}
+
 type IPInterceptorData struct {
-	Redis *redis.ClientConfig `json:"redis"`
 	InterceptData
+	// "deny"(default) or "allow".
+	Mode string `json:"mode"`
+	// Allowed ip or CIDR like "10.0.0.0/8","2001:db8::/32".
+	Allow []string `json:"allow"`
+	// Denied ip or CIDR.
+	Deny []string `json:"deny"`
+	// Only intercept requests of these routes,empty means all routes.
+	Route []string `json:"route"`
+	// Redis client config.
+	// If "allow" and "deny" are both empty and it's nil,use default redis config.
+	Redis *redis.ClientConfig `json:"redis"`
+	// Redis set which members are ip or CIDR,it will be synced into memory.
+	// If it's empty,query ip key in redis for every request.
+	RedisSet string `json:"redisSet"`
+	// Redis set sync interval,millisecond,default is 10000.
+	RedisSyncInterval int `json:"redisSyncInterval"`
+	// Local cache ttl of ip key query,millisecond,default is 1000.
+	CacheTTL int `json:"cacheTTL"`
 }
 
 // Update IPIntercepto,data is *IPInterceptorData
@@ -66,14 +181,59 @@ func (h *IPInterceptor) Update(data interface{}) error {
 	if !ok {
 		return errors.New(`data must be "*IPInterceptorData" type`)
 	}
+	// mode
+	mode := strings.ToLower(d.Mode)
+	if mode == "" {
+		mode = IPInterceptorDeny
+	}
+	if mode != IPInterceptorDeny && mode != IPInterceptorAllow {
+		return fmt.Errorf(`"mode" invalid value "%s"`, d.Mode)
+	}
+	// allow and deny
+	allow, err := newIPTree(d.Allow)
+	if err != nil {
+		return fmt.Errorf(`"allow" %s`, err.Error())
+	}
+	deny, err := newIPTree(d.Deny)
+	if err != nil {
+		return fmt.Errorf(`"deny" %s`, err.Error())
+	}
 	h.InterceptData = d.InterceptData
 	h.InterceptData.Check(http.StatusForbidden)
+	h.mode = mode
+	h.allow = allow
+	h.deny = deny
+	// route
+	h.route = make(map[string]int)
+	for _, s := range d.Route {
+		h.route[s] = 1
+	}
+	// redis
+	if h.syncer != nil {
+		h.syncer.Stop()
+		h.syncer = nil
+	}
+	if h.redis != nil {
+		h.redis.Close()
+		h.redis = nil
+	}
 	if d.Redis != nil {
-		if h.redis != nil {
-			h.redis.Close()
-		}
 		h.redis = redis.NewClient(nil, d.Redis)
 	}
+	cacheTTL := d.CacheTTL
+	if cacheTTL < 1 {
+		cacheTTL = 1000
+	}
+	h.cache = newIPCache(time.Duration(cacheTTL) * time.Millisecond)
+	h.redisSet = d.RedisSet
+	if h.redis != nil && h.redisSet != "" {
+		interval := d.RedisSyncInterval
+		if interval < 1 {
+			interval = 10000
+		}
+		h.syncRedisSet()
+		h.syncer = newIPSyncer(time.Duration(interval)*time.Millisecond, h.syncRedisSet)
+	}
 	return nil
 }
 
@@ -101,7 +261,7 @@ func NewIPInterceptor(data interface{}) (Handler, error) {
 	default:
 		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
 	}
-	if d.Redis == nil {
+	if d.Redis == nil && len(d.Allow) < 1 && len(d.Deny) < 1 {
 		d.Redis = &redis.ClientConfig{}
 	}
 	h := new(IPInterceptor)
@@ -111,3 +271,77 @@ func NewIPInterceptor(data interface{}) (Handler, error) {
 	}
 	return h, nil
 }
+
+// Call sync function periodically.
+type ipSyncer struct {
+	quit chan struct{}
+	wait sync.WaitGroup
+}
+
+func newIPSyncer(interval time.Duration, sync func()) *ipSyncer {
+	s := new(ipSyncer)
+	s.quit = make(chan struct{})
+	s.wait.Add(1)
+	go func() {
+		defer s.wait.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sync()
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// Stop sync routine and wait for it exit.
+func (s *ipSyncer) Stop() {
+	close(s.quit)
+	s.wait.Wait()
+}
+
+// Local cache of ip query result.
+type ipCache struct {
+	sync.Mutex
+	ttl   time.Duration
+	entry map[string]ipCacheEntry
+}
+
+type ipCacheEntry struct {
+	found  bool
+	expire time.Time
+}
+
+func newIPCache(ttl time.Duration) *ipCache {
+	return &ipCache{ttl: ttl, entry: make(map[string]ipCacheEntry)}
+}
+
+// Return query result and true if it's not expired.
+func (c *ipCache) Get(key string) (bool, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entry[key]
+	if !ok || time.Now().After(e.expire) {
+		return false, false
+	}
+	return e.found, true
+}
+
+func (c *ipCache) Set(key string, found bool) {
+	now := time.Now()
+	c.Lock()
+	defer c.Unlock()
+	// Remove expired entries when cache is big.
+	if len(c.entry) >= 65536 {
+		for k, e := range c.entry {
+			if now.After(e.expire) {
+				delete(c.entry, k)
+			}
+		}
+	}
+	c.entry[key] = ipCacheEntry{found: found, expire: now.Add(c.ttl)}
+}
@@ -2,8 +2,12 @@ package handler
 
 import (
 	"mime"
+	"net"
 	"net/http"
 	"testing"
+	"time"
+
+	"github.com/qq51529210/redis"
 )
 
 func Test_IPInterceptor(t *testing.T) {
@@ -34,7 +38,107 @@ func Test_IPInterceptor(t *testing.T) {
 	ip = "192.168.1.3"
 	res.Reset()
 	c.Req.RemoteAddr = ip + ":12345"
+	c.Reset(res, c.Req)
 	if !h.Handle(&c) || res.statusCode == data.StatusCode || res.Header().Get("Content-Type") == data.ContentType || res.body.String() == data.Message {
 		t.FailNow()
 	}
 }
+
+func testIPInterceptorHandle(h Handler, route, remoteAddr string) bool {
+	var c Context
+	c.Reset(&testResponse{}, &http.Request{RemoteAddr: remoteAddr})
+	c.Route = route
+	return h.Handle(&c)
+}
+
+func Test_IPInterceptorCIDR(t *testing.T) {
+	// Deny mode.
+	h, err := NewHandler(IPInterceptorRegisterName(), &IPInterceptorData{
+		Deny:  []string{"192.168.1.0/24", "2001:db8::/32"},
+		Allow: []string{"192.168.1.100"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	if h.(*IPInterceptor).redis != nil {
+		t.FailNow()
+	}
+	for _, s := range []string{"192.168.1.2:1", "192.168.1.255:1", "[2001:db8::1]:1"} {
+		if testIPInterceptorHandle(h, "", s) {
+			t.Fatal(s)
+		}
+	}
+	for _, s := range []string{"192.168.1.100:1", "192.168.2.1:1", "[2001:db9::1]:1"} {
+		if !testIPInterceptorHandle(h, "", s) {
+			t.Fatal(s)
+		}
+	}
+	// Allow mode and route.
+	err = h.Update(&IPInterceptorData{
+		Mode:  IPInterceptorAllow,
+		Allow: []string{"10.0.0.0/8"},
+		Deny:  []string{"10.0.0.1"},
+		Route: []string{"admin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !testIPInterceptorHandle(h, "admin", "10.1.2.3:1") || testIPInterceptorHandle(h, "admin", "10.0.0.1:1") ||
+		testIPInterceptorHandle(h, "admin", "11.0.0.1:1") || !testIPInterceptorHandle(h, "users", "11.0.0.1:1") {
+		t.FailNow()
+	}
+	// Remove redis.
+	err = h.Update(&IPInterceptorData{Deny: []string{"10.0.0.1"}, Redis: &redis.ClientConfig{}})
+	if err != nil || h.(*IPInterceptor).redis == nil {
+		t.FailNow()
+	}
+	err = h.Update(&IPInterceptorData{Deny: []string{"10.0.0.1"}})
+	if err != nil || h.(*IPInterceptor).redis != nil || !testIPInterceptorHandle(h, "", "10.0.0.2:1") {
+		t.FailNow()
+	}
+	// Invalid.
+	if h.Update(&IPInterceptorData{Deny: []string{"10.0.0.0/40"}}) == nil ||
+		h.Update(&IPInterceptorData{Mode: "unknown"}) == nil {
+		t.FailNow()
+	}
+}
+
+func Test_IPTree(t *testing.T) {
+	tree, err := newIPTree([]string{"10.1.0.0/16", "10.0.0.0/8", "1.2.3.4", "::1", "fe80::/10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"10.1.1.1", "10.200.0.1", "1.2.3.4", "::1", "fe80::1", "::ffff:10.0.0.1"} {
+		if !tree.Contains(net.ParseIP(s)) {
+			t.Fatal(s)
+		}
+	}
+	for _, s := range []string{"11.0.0.1", "1.2.3.5", "::2", "fec0::1"} {
+		if tree.Contains(net.ParseIP(s)) {
+			t.Fatal(s)
+		}
+	}
+	var empty *ipTree
+	if empty.Contains(net.ParseIP("1.2.3.4")) {
+		t.FailNow()
+	}
+	_, err = newIPTree([]string{"1.2.3"})
+	if err == nil {
+		t.FailNow()
+	}
+}
+
+func Test_IPCache(t *testing.T) {
+	c := newIPCache(50 * time.Millisecond)
+	c.Set("1.2.3.4", true)
+	found, ok := c.Get("1.2.3.4")
+	if !found || !ok {
+		t.FailNow()
+	}
+	time.Sleep(60 * time.Millisecond)
+	_, ok = c.Get("1.2.3.4")
+	if ok {
+		t.FailNow()
+	}
+}
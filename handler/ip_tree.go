@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// A binary radix tree of ip networks,IPv4 is stored as IPv4-mapped IPv6.
+// It's read only after built.
+type ipTree struct {
+	root ipTreeNode
+}
+
+type ipTreeNode struct {
+	child [2]*ipTreeNode
+	// A network ends at this node.
+	leaf bool
+}
+
+// Create an ipTree from ip or CIDR list.
+func newIPTree(a []string) (*ipTree, error) {
+	t := new(ipTree)
+	for _, s := range a {
+		err := t.Add(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Add ip or CIDR like "10.0.0.0/8","2001:db8::/32".
+func (t *ipTree) Add(s string) error {
+	s = strings.TrimSpace(s)
+	var ip net.IP
+	var ones int
+	if strings.IndexByte(s, '/') < 0 {
+		ip = net.ParseIP(s)
+		if ip == nil {
+			return fmt.Errorf(`invalid ip "%s"`, s)
+		}
+		ones = 8 * net.IPv6len
+	} else {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return err
+		}
+		var bits int
+		ones, bits = n.Mask.Size()
+		ip = n.IP
+		if bits == 8*net.IPv4len {
+			ones += 8 * (net.IPv6len - net.IPv4len)
+		}
+	}
+	ip = ip.To16()
+	node := &t.root
+	for i := 0; i < ones; i++ {
+		if node.leaf {
+			// A bigger network contains it.
+			return nil
+		}
+		b := ipBit(ip, i)
+		if node.child[b] == nil {
+			node.child[b] = new(ipTreeNode)
+		}
+		node = node.child[b]
+	}
+	node.leaf = true
+	// Smaller networks are useless.
+	node.child[0], node.child[1] = nil, nil
+	return nil
+}
+
+// Return true if ip is in any network of tree.
+func (t *ipTree) Contains(ip net.IP) bool {
+	if t == nil {
+		return false
+	}
+	ip = ip.To16()
+	if ip == nil {
+		return false
+	}
+	node := &t.root
+	for i := 0; node != nil; i++ {
+		if node.leaf {
+			return true
+		}
+		if i == 8*net.IPv6len {
+			return false
+		}
+		node = node.child[ipBit(ip, i)]
+	}
+	return false
+}
+
+// Return the bit i of ip.
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// JWT algorithms.
+const (
+	JWTHS256 = "HS256"
+	JWTRS256 = "RS256"
+	JWTES256 = "ES256"
+)
+
+// JWT verification key initial data.
+type JWTKeyData struct {
+	// Key id,match "kid" of token header.
+	Kid string `json:"kid"`
+	// "HS256","RS256" or "ES256".
+	Alg string `json:"alg"`
+	// HS256 secret.
+	Secret string `json:"secret"`
+	// RS256 or ES256 public key or certificate PEM data.
+	PEM string `json:"pem"`
+}
+
+// A JWT verification key.
+type jwtKey struct {
+	kid    string
+	alg    string
+	secret []byte
+	rsa    *rsa.PublicKey
+	ecdsa  *ecdsa.PublicKey
+}
+
+func newJWTKey(d *JWTKeyData) (*jwtKey, error) {
+	k := &jwtKey{kid: d.Kid, alg: d.Alg}
+	switch d.Alg {
+	case JWTHS256:
+		if d.Secret == "" {
+			return nil, errors.New(`"secret" must be defined`)
+		}
+		k.secret = []byte(d.Secret)
+		return k, nil
+	case JWTRS256, JWTES256:
+		block, _ := pem.Decode([]byte(d.PEM))
+		if block == nil {
+			return nil, errors.New(`"pem" invalid data`)
+		}
+		var pub interface{}
+		var err error
+		if block.Type == "CERTIFICATE" {
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				pub = cert.PublicKey
+			}
+		} else {
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return k, k.setPublicKey(pub)
+	default:
+		return nil, fmt.Errorf(`"alg" invalid value "%s"`, d.Alg)
+	}
+}
+
+func (k *jwtKey) setPublicKey(pub interface{}) error {
+	switch v := pub.(type) {
+	case *rsa.PublicKey:
+		if k.alg == JWTRS256 {
+			k.rsa = v
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if k.alg == JWTES256 && v.Curve == elliptic.P256() {
+			k.ecdsa = v
+			return nil
+		}
+	}
+	return fmt.Errorf(`public key does not match "%s"`, k.alg)
+}
+
+// Verify signature of signed data.
+func (k *jwtKey) Verify(signed, signature []byte) bool {
+	hash := sha256.Sum256(signed)
+	switch k.alg {
+	case JWTHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case JWTRS256:
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, hash[:], signature) == nil
+	case JWTES256:
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(k.ecdsa, hash[:], r, s)
+	default:
+		return false
+	}
+}
+
+// A set of keys.
+type jwtKeySet []*jwtKey
+
+// Return keys match kid and alg.
+// If kid is empty,return all keys of alg.
+func (s jwtKeySet) Find(kid, alg string) []*jwtKey {
+	var keys []*jwtKey
+	for _, k := range s {
+		if k.alg == alg && (kid == "" || k.kid == kid) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// A JSON Web Key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// oct
+	K string `json:"k"`
+}
+
+// Parse JWKS data,unsupported keys are ignored.
+func parseJWKS(data []byte) (jwtKeySet, error) {
+	var jwks struct {
+		Keys []*jwk `json:"keys"`
+	}
+	err := json.Unmarshal(data, &jwks)
+	if err != nil {
+		return nil, err
+	}
+	var keys jwtKeySet
+	for _, j := range jwks.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		k, err := j.key()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (j *jwk) key() (*jwtKey, error) {
+	k := &jwtKey{kid: j.Kid}
+	switch j.Kty {
+	case "RSA":
+		k.alg = JWTRS256
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, err
+		}
+		k.rsa = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		if j.Crv != "P-256" {
+			return nil, fmt.Errorf(`unsupported curve "%s"`, j.Crv)
+		}
+		k.alg = JWTES256
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		k.ecdsa = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !k.ecdsa.Curve.IsOnCurve(k.ecdsa.X, k.ecdsa.Y) {
+			return nil, errors.New("invalid ec point")
+		}
+	case "oct":
+		k.alg = JWTHS256
+		secret, err := base64.RawURLEncoding.DecodeString(j.K)
+		if err != nil {
+			return nil, err
+		}
+		k.secret = secret
+	default:
+		return nil, fmt.Errorf(`unsupported key type "%s"`, j.Kty)
+	}
+	if j.Alg != "" && j.Alg != k.alg {
+		return nil, fmt.Errorf(`unsupported alg "%s"`, j.Alg)
+	}
+	return k, nil
+}
+
+// Load JWKS from url or file,refresh periodically or when kid is not found.
+type jwksCache struct {
+	url    string
+	client http.Client
+	// Current keys,value is jwtKeySet.
+	keys atomic.Value
+	// Min interval between two refresh.
+	minInterval time.Duration
+	// Last refresh time.
+	last time.Time
+	lock sync.Mutex
+	quit chan struct{}
+	wait sync.WaitGroup
+}
+
+// Create a jwksCache and load keys,refresh keys every interval.
+func newJWKSCache(url string, interval time.Duration) (*jwksCache, error) {
+	c := new(jwksCache)
+	c.url = url
+	c.client.Timeout = 10 * time.Second
+	c.minInterval = 10 * time.Second
+	if c.minInterval > interval {
+		c.minInterval = interval
+	}
+	c.last = time.Now()
+	err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	c.quit = make(chan struct{})
+	c.wait.Add(1)
+	go c.run(interval)
+	return c, nil
+}
+
+// Stop refresh routine and wait for it exit.
+func (c *jwksCache) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+}
+
+func (c *jwksCache) run(interval time.Duration) {
+	defer c.wait.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := c.load()
+			if err != nil {
+				logError(err)
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// Return current keys.
+func (c *jwksCache) Keys() jwtKeySet {
+	keys, _ := c.keys.Load().(jwtKeySet)
+	return keys
+}
+
+// Reload keys if last refresh is before min interval,use for key rotation.
+// Return true if keys was reloaded.
+func (c *jwksCache) Refresh() bool {
+	c.lock.Lock()
+	if time.Since(c.last) < c.minInterval {
+		c.lock.Unlock()
+		return false
+	}
+	c.last = time.Now()
+	c.lock.Unlock()
+	err := c.load()
+	if err != nil {
+		logError(err)
+		return false
+	}
+	return true
+}
+
+func (c *jwksCache) load() error {
+	var data []byte
+	var err error
+	if strings.HasPrefix(c.url, "http://") || strings.HasPrefix(c.url, "https://") {
+		var res *http.Response
+		res, err = c.client.Get(c.url)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf(`jwks "%s" response %d`, c.url, res.StatusCode)
+		}
+		data, err = ioutil.ReadAll(res.Body)
+	} else {
+		data, err = ioutil.ReadFile(strings.TrimPrefix(c.url, "file://"))
+	}
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf(`jwks "%s" %s`, c.url, err.Error())
+	}
+	c.keys.Store(keys)
+	return nil
+}
@@ -0,0 +1,333 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	// JWTInterceptor register name.
+	jwtInterceptorRegisterName = HandlerName(&JWTInterceptor{})
+)
+
+func init() {
+	// Register JWTInterceptor.
+	RegisterHandler(jwtInterceptorRegisterName, NewJWTInterceptor)
+}
+
+// Get JWTInterceptor register name.
+func JWTInterceptorRegisterName() string {
+	return jwtInterceptorRegisterName
+}
+
+// A Interceptor that validates JWT bearer token locally.
+// Verified claims are saved in Context.Data as *Identity.
+type JWTInterceptor struct {
+	InterceptData
+	// Allowed algorithms.
+	algorithm map[string]int
+	// Keys from configure.
+	keys jwtKeySet
+	// Keys from JWKS.
+	jwks *jwksCache
+	// Allowed "iss".
+	issuer map[string]int
+	// Allowed "aud".
+	audience map[string]int
+	// Clock skew.
+	leeway time.Duration
+	// Required claims and allowed values.
+	requiredClaim map[string][]string
+	// Cookie name of token.
+	CookieName string
+	// Claims forward to upstream,key is claim name,value is header name.
+	ClaimHeader map[string]string
+}
+
+func (h *JWTInterceptor) Release() {
+	if h.jwks != nil {
+		h.jwks.Stop()
+		h.jwks = nil
+	}
+}
+
+func (h *JWTInterceptor) Handle(c *Context) bool {
+	claims, err := h.Verify(h.token(c))
+	if err != nil {
+		removeIdentityHeader(c.Req.Header, h.ClaimHeader)
+		c.Res.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		h.InterceptData.WriteToResponse(c.Res)
+		return false
+	}
+	id := NewIdentity(claims)
+	id.SetHeader(c.Req.Header, h.ClaimHeader)
+	c.Data = id
+	return true
+}
+
+// Return token from "Authorization" header or cookie.
+func (h *JWTInterceptor) token(c *Context) string {
+	const bearerTokenPrefix = "Bearer "
+	str := c.Req.Header.Get("Authorization")
+	if strings.HasPrefix(str, bearerTokenPrefix) {
+		return str[len(bearerTokenPrefix):]
+	}
+	if h.CookieName != "" {
+		cookie, _ := c.Req.Cookie(h.CookieName)
+		if cookie != nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// Verify token and return claims.
+func (h *JWTInterceptor) Verify(token string) (map[string]interface{}, error) {
+	part := strings.Split(token, ".")
+	if len(part) != 3 {
+		return nil, errors.New("invalid token")
+	}
+	// Header.
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := jwtDecode(part[0], &header)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := h.algorithm[header.Alg]; !ok {
+		return nil, fmt.Errorf(`invalid alg "%s"`, header.Alg)
+	}
+	// Signature.
+	signature, err := base64.RawURLEncoding.DecodeString(part[2])
+	if err != nil {
+		return nil, err
+	}
+	signed := []byte(token[:len(part[0])+1+len(part[1])])
+	if !h.verifySignature(header.Kid, header.Alg, signed, signature) {
+		return nil, errors.New("invalid signature")
+	}
+	// Claims.
+	var claims map[string]interface{}
+	err = jwtDecode(part[1], &claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, h.checkClaims(claims)
+}
+
+func (h *JWTInterceptor) verifySignature(kid, alg string, signed, signature []byte) bool {
+	keys := h.keys.Find(kid, alg)
+	if h.jwks != nil {
+		jwksKeys := h.jwks.Keys().Find(kid, alg)
+		// Key may be rotated.
+		if len(jwksKeys) < 1 && kid != "" && h.jwks.Refresh() {
+			jwksKeys = h.jwks.Keys().Find(kid, alg)
+		}
+		keys = append(keys, jwksKeys...)
+	}
+	for _, k := range keys {
+		if k.Verify(signed, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *JWTInterceptor) checkClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	// exp
+	if v, ok := claims["exp"]; ok {
+		exp, ok := v.(float64)
+		if !ok || now.Add(-h.leeway).After(jwtTime(exp)) {
+			return errors.New("token is expired")
+		}
+	}
+	// nbf
+	if v, ok := claims["nbf"]; ok {
+		nbf, ok := v.(float64)
+		if !ok || now.Add(h.leeway).Before(jwtTime(nbf)) {
+			return errors.New("token is not valid yet")
+		}
+	}
+	// iss
+	if len(h.issuer) > 0 {
+		if _, ok := h.issuer[claimString(claims["iss"])]; !ok {
+			return errors.New("invalid issuer")
+		}
+	}
+	// aud
+	if len(h.audience) > 0 && !jwtContains(h.audience, claimStrings(claims["aud"])) {
+		return errors.New("invalid audience")
+	}
+	// Required claims.
+	for k, v := range h.requiredClaim {
+		value, ok := claims[k]
+		if !ok {
+			return fmt.Errorf(`claim "%s" is required`, k)
+		}
+		if len(v) < 1 {
+			continue
+		}
+		allowed := make(map[string]int)
+		for _, s := range v {
+			allowed[s] = 1
+		}
+		if !jwtContains(allowed, claimStrings(value)) {
+			return fmt.Errorf(`claim "%s" invalid value`, k)
+		}
+	}
+	return nil
+}
+
+// Return true if any of a is in m.
+func jwtContains(m map[string]int, a []string) bool {
+	for _, s := range a {
+		if _, ok := m[s]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert NumericDate to time.
+func jwtTime(f float64) time.Time {
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*float64(time.Second)))
+}
+
+// Decode base64url json.
+func jwtDecode(s string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+type JWTInterceptorData struct {
+	InterceptData
+	// Allowed algorithms,"HS256","RS256" or "ES256",default is all.
+	Algorithm []string `json:"algorithm"`
+	// Verification keys.
+	Key []*JWTKeyData `json:"key"`
+	// JWKS url("http://","https://") or file path.
+	JWKSUrl string `json:"jwksUrl"`
+	// JWKS refresh interval,millisecond,default is 300000.
+	// Unknown "kid" also triggers a refresh,no more than once in 10 seconds.
+	JWKSRefreshInterval int `json:"jwksRefreshInterval"`
+	// Allowed "iss",empty means don't check.
+	Issuer []string `json:"issuer"`
+	// Allowed "aud",empty means don't check.
+	Audience []string `json:"audience"`
+	// Clock skew of "exp" and "nbf",millisecond.
+	Leeway int `json:"leeway"`
+	// Required claims,key is claim name,value is allowed values,empty means any value.
+	RequiredClaim map[string][]string `json:"requiredClaim"`
+	// Also read token from this cookie.
+	CookieName string `json:"cookieName"`
+	// Claims forward to upstream,key is claim name,value is header name,
+	// like {"sub": "X-User-Id"}.
+	ClaimHeader map[string]string `json:"claimHeader"`
+}
+
+func (h *JWTInterceptor) Update(data interface{}) error {
+	d, ok := data.(*JWTInterceptorData)
+	if !ok {
+		return errors.New(`data must be "*JWTInterceptorData" type`)
+	}
+	// algorithm
+	algorithm := make(map[string]int)
+	algs := d.Algorithm
+	if len(algs) < 1 {
+		algs = []string{JWTHS256, JWTRS256, JWTES256}
+	}
+	for _, s := range algs {
+		if s != JWTHS256 && s != JWTRS256 && s != JWTES256 {
+			return fmt.Errorf(`"algorithm" invalid value "%s"`, s)
+		}
+		algorithm[s] = 1
+	}
+	// key
+	var keys jwtKeySet
+	for i, k := range d.Key {
+		key, err := newJWTKey(k)
+		if err != nil {
+			return fmt.Errorf(`"key"[%d] %s`, i, err.Error())
+		}
+		keys = append(keys, key)
+	}
+	// jwksUrl
+	var jwks *jwksCache
+	if d.JWKSUrl != "" {
+		interval := d.JWKSRefreshInterval
+		if interval < 1 {
+			interval = 300000
+		}
+		var err error
+		jwks, err = newJWKSCache(d.JWKSUrl, time.Duration(interval)*time.Millisecond)
+		if err != nil {
+			return err
+		}
+	}
+	if len(keys) < 1 && jwks == nil {
+		return errors.New(`"key" or "jwksUrl" must be defined`)
+	}
+	h.InterceptData = d.InterceptData
+	h.InterceptData.Check(http.StatusUnauthorized)
+	h.algorithm = algorithm
+	h.keys = keys
+	if h.jwks != nil {
+		h.jwks.Stop()
+	}
+	h.jwks = jwks
+	h.issuer = make(map[string]int)
+	for _, s := range d.Issuer {
+		h.issuer[s] = 1
+	}
+	h.audience = make(map[string]int)
+	for _, s := range d.Audience {
+		h.audience[s] = 1
+	}
+	h.leeway = time.Duration(d.Leeway) * time.Millisecond
+	h.requiredClaim = d.RequiredClaim
+	h.CookieName = d.CookieName
+	h.ClaimHeader = d.ClaimHeader
+	return nil
+}
+
+// Create a new JWTInterceptor
+func NewJWTInterceptor(data interface{}) (Handler, error) {
+	var d *JWTInterceptorData
+	switch v := data.(type) {
+	case *JWTInterceptorData:
+		d = v
+	case string:
+		d = new(JWTInterceptorData)
+		err := json.Unmarshal([]byte(v), d)
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		d = new(JWTInterceptorData)
+		err := Map2Struct(v, d)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
+	}
+	h := new(JWTInterceptor)
+	err := h.Update(d)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Sign a test token,key is []byte,*rsa.PrivateKey or *ecdsa.PrivateKey.
+func testJWTSign(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	var signature []byte
+	var err error
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, hash[:])
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func Test_JWTInterceptor(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	secret := []byte("secret")
+	h, err := NewHandler(JWTInterceptorRegisterName(), &JWTInterceptorData{
+		Key: []*JWTKeyData{
+			{Alg: JWTHS256, Secret: string(secret)},
+			{Kid: "ec1", Alg: JWTES256, PEM: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))},
+		},
+		Issuer:        []string{"gateway"},
+		Audience:      []string{"api"},
+		RequiredClaim: map[string][]string{"tenant": nil, "roles": {"admin", "user"}},
+		ClaimHeader:   map[string]string{"sub": "X-User-Id", "roles": "X-User-Roles"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":    "1001",
+			"iss":    "gateway",
+			"aud":    []string{"web", "api"},
+			"exp":    time.Now().Add(time.Minute).Unix(),
+			"tenant": "a",
+			"roles":  []string{"user"},
+			"scope":  "read write",
+		}
+	}
+	// HS256 and ES256.
+	for _, token := range []string{
+		testJWTSign(t, JWTHS256, "", secret, claims()),
+		testJWTSign(t, JWTES256, "ec1", ecKey, claims()),
+	} {
+		c, res := testHandle(h, "", testBearerRequest(token))
+		id := c.Identity()
+		if res.statusCode != 0 || id == nil || id.Subject != "1001" || len(id.Scopes) != 2 ||
+			c.Req.Header.Get("X-User-Id") != "1001" || c.Req.Header.Get("X-User-Roles") != "user" {
+			t.FailNow()
+		}
+	}
+	// Invalid tokens.
+	expired := claims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	notBefore := claims()
+	notBefore["nbf"] = time.Now().Add(time.Minute).Unix()
+	badIssuer := claims()
+	badIssuer["iss"] = "other"
+	badAudience := claims()
+	badAudience["aud"] = "web"
+	noTenant := claims()
+	delete(noTenant, "tenant")
+	badRole := claims()
+	badRole["roles"] = "guest"
+	for i, token := range []string{
+		"",
+		"a.b.c",
+		testJWTSign(t, JWTHS256, "", []byte("other"), claims()),
+		testJWTSign(t, JWTES256, "ec2", ecKey, claims()),
+		testJWTSign(t, JWTHS256, "", secret, expired),
+		testJWTSign(t, JWTHS256, "", secret, notBefore),
+		testJWTSign(t, JWTHS256, "", secret, badIssuer),
+		testJWTSign(t, JWTHS256, "", secret, badAudience),
+		testJWTSign(t, JWTHS256, "", secret, noTenant),
+		testJWTSign(t, JWTHS256, "", secret, badRole),
+	} {
+		req := testBearerRequest(token)
+		req.Header.Set("X-User-Id", "fake")
+		c, res := testHandle(h, "", req)
+		if res.statusCode != http.StatusUnauthorized || c.Identity() != nil || c.Req.Header.Get("X-User-Id") != "" ||
+			res.Header().Get("WWW-Authenticate") == "" {
+			t.Fatal(i)
+		}
+	}
+	// Algorithm not allowed.
+	err = h.Update(&JWTInterceptorData{
+		Algorithm: []string{JWTES256},
+		Key:       []*JWTKeyData{{Alg: JWTHS256, Secret: string(secret)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, res := testHandle(h, "", testBearerRequest(testJWTSign(t, JWTHS256, "", secret, claims())))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+}
+
+func Test_JWTInterceptorJWKS(t *testing.T) {
+	rsaKey1, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey2, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := func(kid string, key *rsa.PrivateKey) []byte {
+		data, _ := json.Marshal(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+		return data
+	}
+	var current atomic.Value
+	current.Store(jwks("rsa1", rsaKey1))
+	var loads int32
+	ser := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&loads, 1)
+		rw.Write(current.Load().([]byte))
+	}))
+	defer ser.Close()
+	h, err := NewHandler(JWTInterceptorRegisterName(), &JWTInterceptorData{
+		JWKSUrl: ser.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	h.(*JWTInterceptor).jwks.minInterval = 0
+	claims := map[string]interface{}{"sub": "1001"}
+	_, res := testHandle(h, "", testBearerRequest(testJWTSign(t, JWTRS256, "rsa1", rsaKey1, claims)))
+	if res.statusCode != 0 {
+		t.FailNow()
+	}
+	// Rotate key,unknown kid triggers refresh.
+	current.Store(jwks("rsa2", rsaKey2))
+	_, res = testHandle(h, "", testBearerRequest(testJWTSign(t, JWTRS256, "rsa2", rsaKey2, claims)))
+	if res.statusCode != 0 || atomic.LoadInt32(&loads) != 2 {
+		t.FailNow()
+	}
+	// Old key was removed.
+	_, res = testHandle(h, "", testBearerRequest(testJWTSign(t, JWTRS256, "rsa1", rsaKey1, claims)))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+var (
+	// Global error logger,value is errorLogger.
+	globalErrorLogger atomic.Value
+)
+
+func init() {
+	SetErrorLogger(nil)
+}
+
+// Wrap function,because atomic.Value can't store nil.
+type errorLogger struct {
+	log func(error)
+}
+
+// Set global error logger.
+// It receives errors which handlers can't return,like upstream and store errors.
+// If f is nil,use standard logger.
+func SetErrorLogger(f func(error)) {
+	if f == nil {
+		f = func(err error) {
+			log.Println(err)
+		}
+	}
+	globalErrorLogger.Store(errorLogger{log: f})
+}
+
+// Log error by global error logger.
+func logError(err error) {
+	globalErrorLogger.Load().(errorLogger).log(err)
+}
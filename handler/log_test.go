@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_SetErrorLogger(t *testing.T) {
+	var logged error
+	SetErrorLogger(func(err error) {
+		logged = err
+	})
+	defer SetErrorLogger(nil)
+	err := errors.New("test")
+	logError(err)
+	if logged != err {
+		t.FailNow()
+	}
+}
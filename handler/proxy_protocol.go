@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// PROXY protocol v2 signature.
+	proxyProtocolV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	// PROXY protocol header read timeout.
+	proxyProtocolTimeout = 5 * time.Second
+)
+
+// A net.Listener which reads PROXY protocol(v1 and v2) header of connection from trusted proxy.
+// Connections from other peers are not changed.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted ipNets
+}
+
+// Wrap listener with PROXY protocol support,only trusted proxy can send PROXY header.
+func NewProxyProtocolListener(listener net.Listener, trustedProxy []string) (net.Listener, error) {
+	trusted, err := parseIPNets(trustedProxy)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolListener{Listener: listener, trusted: trusted}, nil
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !l.trusted.Contains(addr.IP) {
+		return conn, nil
+	}
+	// Header is read in connection serve goroutine.
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// Connection from trusted proxy.
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	// Client address in PROXY header.
+	remoteAddr net.Addr
+	// Error of reading PROXY header.
+	err error
+}
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolTimeout))
+		c.remoteAddr, c.err = readProxyProtocol(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// Read PROXY header,return nil address if it's "UNKNOWN" or "LOCAL".
+func readProxyProtocol(reader *bufio.Reader) (net.Addr, error) {
+	sig, err := reader.Peek(len(proxyProtocolV2Sig))
+	if err == nil && bytes.Equal(sig, proxyProtocolV2Sig) {
+		return readProxyProtocolV2(reader)
+	}
+	sig, err = reader.Peek(6)
+	if err != nil {
+		return nil, err
+	}
+	if string(sig) != "PROXY " {
+		return nil, errors.New("invalid PROXY protocol header")
+	}
+	return readProxyProtocolV1(reader)
+}
+
+// "PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\n"
+func readProxyProtocolV1(reader *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < 107 {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("invalid PROXY protocol v1 header")
+	}
+	field := strings.Split(string(line[:len(line)-2]), " ")
+	if len(field) > 1 && field[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(field) != 6 || (field[1] != "TCP4" && field[1] != "TCP6") {
+		return nil, errors.New("invalid PROXY protocol v1 header")
+	}
+	ip := net.ParseIP(field[2])
+	port, err := strconv.ParseUint(field[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, errors.New("invalid PROXY protocol v1 address")
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// 12 bytes signature,1 byte version and command,1 byte family,2 bytes length,addresses.
+func readProxyProtocolV2(reader *bufio.Reader) (net.Addr, error) {
+	var header [16]byte
+	_, err := io.ReadFull(reader, header[:])
+	if err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, errors.New("invalid PROXY protocol v2 version")
+	}
+	data := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	_, err = io.ReadFull(reader, data)
+	if err != nil {
+		return nil, err
+	}
+	// LOCAL command.
+	if header[12]&0x0f == 0 {
+		return nil, nil
+	}
+	switch header[13] >> 4 {
+	case 1:
+		// AF_INET,src ip,dst ip,src port,dst port.
+		if len(data) < 12 {
+			return nil, errors.New("invalid PROXY protocol v2 address")
+		}
+		return &net.TCPAddr{IP: net.IP(data[:4]), Port: int(binary.BigEndian.Uint16(data[8:]))}, nil
+	case 2:
+		// AF_INET6.
+		if len(data) < 36 {
+			return nil, errors.New("invalid PROXY protocol v2 address")
+		}
+		return &net.TCPAddr{IP: net.IP(data[:16]), Port: int(binary.BigEndian.Uint16(data[32:]))}, nil
+	default:
+		return nil, nil
+	}
+}
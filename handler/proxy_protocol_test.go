@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_ReadProxyProtocol(t *testing.T) {
+	// v1
+	reader := bufio.NewReader(strings.NewReader("PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\nGET"))
+	addr, err := readProxyProtocol(reader)
+	if err != nil || addr.String() != "1.2.3.4:1111" {
+		t.Fatal(addr, err)
+	}
+	rest, _ := reader.Peek(3)
+	if string(rest) != "GET" {
+		t.FailNow()
+	}
+	reader = bufio.NewReader(strings.NewReader("PROXY TCP6 2001:db8::1 ::1 1111 2222\r\n"))
+	addr, err = readProxyProtocol(reader)
+	if err != nil || addr.String() != "[2001:db8::1]:1111" {
+		t.Fatal(addr, err)
+	}
+	reader = bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n"))
+	addr, err = readProxyProtocol(reader)
+	if err != nil || addr != nil {
+		t.Fatal(addr, err)
+	}
+	reader = bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n"))
+	_, err = readProxyProtocol(reader)
+	if err == nil {
+		t.FailNow()
+	}
+	// v2,PROXY command,AF_INET,STREAM.
+	var b strings.Builder
+	b.Write(proxyProtocolV2Sig)
+	b.Write([]byte{0x21, 0x11})
+	var n [2]byte
+	binary.BigEndian.PutUint16(n[:], 12)
+	b.Write(n[:])
+	b.Write([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	binary.BigEndian.PutUint16(n[:], 1111)
+	b.Write(n[:])
+	binary.BigEndian.PutUint16(n[:], 2222)
+	b.Write(n[:])
+	reader = bufio.NewReader(strings.NewReader(b.String()))
+	addr, err = readProxyProtocol(reader)
+	if err != nil || addr.String() != "1.2.3.4:1111" {
+		t.Fatal(addr, err)
+	}
+}
+
+func Test_ProxyProtocolListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err = NewProxyProtocolListener(l, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteAddr := make(chan string, 1)
+	ser := &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		remoteAddr <- r.RemoteAddr
+	})}
+	go ser.Serve(l)
+	defer ser.Close()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("PROXY TCP4 1.2.3.4 5.6.7.8 1111 80\r\nGET / HTTP/1.1\r\nHost: a\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if <-remoteAddr != "1.2.3.4:1111" {
+		t.FailNow()
+	}
+}
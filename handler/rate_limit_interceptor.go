@@ -0,0 +1,479 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qq51529210/redis"
+)
+
+var (
+	// RateLimitInterceptor register name.
+	rateLimitInterceptorRegisterName = HandlerName(&RateLimitInterceptor{})
+)
+
+func init() {
+	// Register RateLimitInterceptor.
+	RegisterHandler(rateLimitInterceptorRegisterName, NewRateLimitInterceptor)
+}
+
+// Get RateLimitInterceptor register name.
+func RateLimitInterceptorRegisterName() string {
+	return rateLimitInterceptorRegisterName
+}
+
+const (
+	// Token bucket,allow burst,default algorithm.
+	RateLimitTokenBucket = "tokenBucket"
+	// Sliding window counter.
+	RateLimitSlidingWindow = "slidingWindow"
+)
+
+// Token bucket script,KEYS[1] is key,ARGV is limit,period,burst,now(millisecond).
+// Return allowed(0/1),remaining tokens and milliseconds to next token.
+const rateLimitTokenBucketScript = `
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+local bucket = redis.call('HMGET', KEYS[1], 't', 'ts')
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * limit / period)
+else
+	now = ts
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 't', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * period / limit) + period)
+return {allowed, math.floor(tokens), math.ceil((1 - tokens % 1) * period / limit)}
+`
+
+// Sliding window script,KEYS[1] is current window,KEYS[2] is previous window,
+// ARGV is limit,weight of previous window,expire(millisecond).
+// Return allowed(0/1),current and previous window count.
+const rateLimitSlidingWindowScript = `
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+local cur = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+if prev * weight + cur >= limit then
+	return {0, cur, prev}
+end
+cur = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {1, cur, prev}
+`
+
+// Result of taking one request from limiter.
+type rateLimitResult struct {
+	allowed bool
+	// Remaining requests.
+	remaining int
+	// How long to wait before next request will be allowed.
+	retryAfter time.Duration
+	// How long before limit fully resets.
+	reset time.Duration
+}
+
+// Rate limit algorithm and store.
+type rateLimiter interface {
+	Take(key string, now time.Time) (*rateLimitResult, error)
+	Release()
+}
+
+// Use for limit request rate.
+// Exceeded request will get 429 with "Retry-After" header.
+type RateLimitInterceptor struct {
+	InterceptData
+	// Requests per Period.
+	Limit int
+	// Time period.
+	Period time.Duration
+	// Key,"ip","header:Name","token"(identity subject) or "route".
+	Key string
+	// Algorithm and store.
+	limiter rateLimiter
+}
+
+func (h *RateLimitInterceptor) Release() {
+	if h.limiter != nil {
+		h.limiter.Release()
+	}
+}
+
+func (h *RateLimitInterceptor) Handle(c *Context) bool {
+	r, err := h.limiter.Take(h.key(c), time.Now())
+	if err != nil {
+		// Store error,let request pass.
+		logError(err)
+		return true
+	}
+	header := c.Res.Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(h.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(r.remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(durationSeconds(r.reset), 10))
+	if r.allowed {
+		return true
+	}
+	header.Set("Retry-After", strconv.FormatInt(durationSeconds(r.retryAfter), 10))
+	h.InterceptData.WriteToResponse(c.Res)
+	return false
+}
+
+// Return limit key of request.
+// Request without identity or header is limited by client ip.
+func (h *RateLimitInterceptor) key(c *Context) string {
+	switch {
+	case h.Key == "route":
+		return "route:" + c.Route
+	case h.Key == "token":
+		if id := c.Identity(); id != nil && id.Subject != "" {
+			return "token:" + id.Subject
+		}
+	case strings.HasPrefix(h.Key, "header:"):
+		if str := c.Req.Header.Get(h.Key[len("header:"):]); str != "" {
+			return "header:" + str
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+type RateLimitInterceptorData struct {
+	InterceptData
+	// "tokenBucket" or "slidingWindow",default is "tokenBucket".
+	Algorithm string `json:"algorithm"`
+	// Requests per period,must be defined.
+	Limit int `json:"limit"`
+	// Time period,millisecond,default is 1000.
+	Period int `json:"period"`
+	// Token bucket capacity,default is Limit.
+	Burst int `json:"burst"`
+	// Limit key,"ip","header:Name","token" or "route",default is "ip".
+	// "token" is subject of Context.Identity,use it after authentication handlers.
+	// Request without identity or header is limited by client ip.
+	Key string `json:"key"`
+	// If it's not nil,use redis store,so that limits are shared across gateways.
+	// Else,use in-process store.
+	Redis *redis.ClientConfig `json:"redis"`
+	// Redis key prefix,default is "ratelimit:".
+	RedisPrefix string `json:"redisPrefix"`
+}
+
+// Update RateLimitInterceptor,data is *RateLimitInterceptorData
+func (h *RateLimitInterceptor) Update(data interface{}) error {
+	d, ok := data.(*RateLimitInterceptorData)
+	if !ok {
+		return errors.New(`data must be "*RateLimitInterceptorData" type`)
+	}
+	if d.Limit < 1 {
+		return errors.New(`"limit" must be greater than 0`)
+	}
+	switch {
+	case d.Key == "", d.Key == "ip", d.Key == "token", d.Key == "route":
+	case strings.HasPrefix(d.Key, "header:") && len(d.Key) > len("header:"):
+	default:
+		return fmt.Errorf(`"key" invalid value "%s"`, d.Key)
+	}
+	period := time.Duration(d.Period) * time.Millisecond
+	if period < 1 {
+		period = time.Second
+	}
+	burst := d.Burst
+	if burst < 1 {
+		burst = d.Limit
+	}
+	prefix := d.RedisPrefix
+	if prefix == "" {
+		prefix = "ratelimit:"
+	}
+	var limiter rateLimiter
+	switch d.Algorithm {
+	case "", RateLimitTokenBucket:
+		if d.Redis != nil {
+			limiter = &redisTokenBucket{redis: redis.NewClient(nil, d.Redis), prefix: prefix, limit: d.Limit, period: period, burst: burst}
+		} else {
+			limiter = newLocalTokenBucket(d.Limit, period, burst)
+		}
+	case RateLimitSlidingWindow:
+		if d.Redis != nil {
+			limiter = &redisSlidingWindow{redis: redis.NewClient(nil, d.Redis), prefix: prefix, limit: d.Limit, period: period}
+		} else {
+			limiter = newLocalSlidingWindow(d.Limit, period)
+		}
+	default:
+		return fmt.Errorf(`"algorithm" invalid value "%s"`, d.Algorithm)
+	}
+	h.InterceptData = d.InterceptData
+	h.InterceptData.Check(http.StatusTooManyRequests)
+	h.Limit = d.Limit
+	h.Period = period
+	h.Key = d.Key
+	if h.limiter != nil {
+		h.limiter.Release()
+	}
+	h.limiter = limiter
+	return nil
+}
+
+// Create a new RateLimitInterceptor
+func NewRateLimitInterceptor(data interface{}) (Handler, error) {
+	var d *RateLimitInterceptorData
+	switch v := data.(type) {
+	case *RateLimitInterceptorData:
+		d = v
+	case string:
+		d = new(RateLimitInterceptorData)
+		err := json.Unmarshal([]byte(v), d)
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		d = new(RateLimitInterceptorData)
+		err := Map2Struct(v, d)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
+	}
+	h := new(RateLimitInterceptor)
+	err := h.Update(d)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Round up to seconds.
+func durationSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// Calculate sliding window result.
+// Arg elapsed is time since current window start.
+func slidingWindowResult(allowed bool, limit int, period, elapsed time.Duration, cur, prev int64) *rateLimitResult {
+	r := new(rateLimitResult)
+	r.allowed = allowed
+	weight := 1 - float64(elapsed)/float64(period)
+	count := float64(prev)*weight + float64(cur)
+	r.remaining = int(float64(limit) - count)
+	if r.remaining < 0 {
+		r.remaining = 0
+	}
+	r.reset = 2*period - elapsed
+	if cur == 0 {
+		r.reset = period - elapsed
+	}
+	if !allowed {
+		// Wait until previous window weight decrease enough.
+		r.retryAfter = period - elapsed
+		if prev > 0 && cur < int64(limit) {
+			t := time.Duration(float64(period)*(1-float64(int64(limit)-cur)/float64(prev))) - elapsed
+			if t > 0 && t < r.retryAfter {
+				r.retryAfter = t
+			}
+		}
+	}
+	return r
+}
+
+// In-process token bucket.
+type localTokenBucket struct {
+	sync.Mutex
+	limit  int
+	period time.Duration
+	burst  int
+	bucket map[string]*tokenBucket
+	// Last time remove idle buckets.
+	sweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLocalTokenBucket(limit int, period time.Duration, burst int) *localTokenBucket {
+	return &localTokenBucket{
+		limit:  limit,
+		period: period,
+		burst:  burst,
+		bucket: make(map[string]*tokenBucket),
+		sweep:  time.Now(),
+	}
+}
+
+// Time to fill bucket.
+func (l *localTokenBucket) fillTime() time.Duration {
+	return time.Duration(float64(l.burst) * float64(l.period) / float64(l.limit))
+}
+
+func (l *localTokenBucket) Take(key string, now time.Time) (*rateLimitResult, error) {
+	l.Lock()
+	defer l.Unlock()
+	// Full buckets are same as new buckets,remove them.
+	if now.Sub(l.sweep) > l.fillTime()+l.period {
+		for k, b := range l.bucket {
+			if now.Sub(b.last) > l.fillTime() {
+				delete(l.bucket, k)
+			}
+		}
+		l.sweep = now
+	}
+	b, ok := l.bucket[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.bucket[key] = b
+	}
+	if now.After(b.last) {
+		b.tokens += float64(now.Sub(b.last)) * float64(l.limit) / float64(l.period)
+		if b.tokens > float64(l.burst) {
+			b.tokens = float64(l.burst)
+		}
+		b.last = now
+	}
+	r := new(rateLimitResult)
+	if b.tokens >= 1 {
+		b.tokens--
+		r.allowed = true
+	}
+	r.remaining = int(b.tokens)
+	perToken := float64(l.period) / float64(l.limit)
+	r.retryAfter = time.Duration((1 - (b.tokens - math.Floor(b.tokens))) * perToken)
+	r.reset = time.Duration((float64(l.burst) - b.tokens) * perToken)
+	return r, nil
+}
+
+func (l *localTokenBucket) Release() {}
+
+// In-process sliding window counter.
+type localSlidingWindow struct {
+	sync.Mutex
+	limit  int
+	period time.Duration
+	window map[string]*slidingWindow
+	// Current window start time.
+	start time.Time
+}
+
+type slidingWindow struct {
+	cur  int64
+	prev int64
+}
+
+func newLocalSlidingWindow(limit int, period time.Duration) *localSlidingWindow {
+	return &localSlidingWindow{
+		limit:  limit,
+		period: period,
+		window: make(map[string]*slidingWindow),
+		start:  time.Now().Truncate(period),
+	}
+}
+
+func (l *localSlidingWindow) Take(key string, now time.Time) (*rateLimitResult, error) {
+	l.Lock()
+	defer l.Unlock()
+	// Move windows.
+	start := now.Truncate(l.period)
+	if start.After(l.start) {
+		next := start.Sub(l.start) == l.period
+		for k, w := range l.window {
+			if !next || w.cur == 0 {
+				delete(l.window, k)
+				continue
+			}
+			w.prev = w.cur
+			w.cur = 0
+		}
+		l.start = start
+	}
+	w, ok := l.window[key]
+	if !ok {
+		w = new(slidingWindow)
+		l.window[key] = w
+	}
+	elapsed := now.Sub(l.start)
+	weight := 1 - float64(elapsed)/float64(l.period)
+	allowed := float64(w.prev)*weight+float64(w.cur) < float64(l.limit)
+	if allowed {
+		w.cur++
+	}
+	return slidingWindowResult(allowed, l.limit, l.period, elapsed, w.cur, w.prev), nil
+}
+
+func (l *localSlidingWindow) Release() {}
+
+// Redis token bucket.
+type redisTokenBucket struct {
+	redis  *redis.Client
+	prefix string
+	limit  int
+	period time.Duration
+	burst  int
+}
+
+func (l *redisTokenBucket) Take(key string, now time.Time) (*rateLimitResult, error) {
+	value, err := l.redis.Cmd("EVAL", rateLimitTokenBucketScript, 1, l.prefix+key,
+		l.limit, int64(l.period/time.Millisecond), l.burst, now.UnixNano()/int64(time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+	n, err := redisInts(value, 3)
+	if err != nil {
+		return nil, err
+	}
+	r := new(rateLimitResult)
+	r.allowed = n[0] == 1
+	r.remaining = int(n[1])
+	r.retryAfter = time.Duration(n[2]) * time.Millisecond
+	r.reset = time.Duration(float64(int64(l.burst)-n[1]) * float64(l.period) / float64(l.limit))
+	return r, nil
+}
+
+func (l *redisTokenBucket) Release() {
+	l.redis.Close()
+}
+
+// Redis sliding window counter.
+type redisSlidingWindow struct {
+	redis  *redis.Client
+	prefix string
+	limit  int
+	period time.Duration
+}
+
+func (l *redisSlidingWindow) Take(key string, now time.Time) (*rateLimitResult, error) {
+	index := now.UnixNano() / int64(l.period)
+	elapsed := time.Duration(now.UnixNano() - index*int64(l.period))
+	weight := 1 - float64(elapsed)/float64(l.period)
+	value, err := l.redis.Cmd("EVAL", rateLimitSlidingWindowScript, 2,
+		l.prefix+key+":"+strconv.FormatInt(index, 10),
+		l.prefix+key+":"+strconv.FormatInt(index-1, 10),
+		l.limit, strconv.FormatFloat(weight, 'f', 6, 64), int64(2*l.period/time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+	n, err := redisInts(value, 3)
+	if err != nil {
+		return nil, err
+	}
+	return slidingWindowResult(n[0] == 1, l.limit, l.period, elapsed, n[1], n[2]), nil
+}
+
+func (l *redisSlidingWindow) Release() {
+	l.redis.Close()
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/qq51529210/redis"
+)
+
+func testRateLimitInterceptor(t *testing.T, data *RateLimitInterceptorData) {
+	data.StatusCode = 429
+	data.ContentType = mime.TypeByExtension(".json")
+	data.Message = `{"message": "Too many requests!"}`
+	data.Limit = 2
+	data.Period = 100
+	h, err := NewHandler(RateLimitInterceptorRegisterName(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+
+	var c Context
+	req := &http.Request{
+		RemoteAddr: "192.168.1.2:12345",
+	}
+	for i := 0; i < 2; i++ {
+		res := &testResponse{}
+		c.Reset(res, req)
+		if !h.Handle(&c) || res.Header().Get("X-RateLimit-Limit") != "2" {
+			t.FailNow()
+		}
+	}
+	res := &testResponse{}
+	c.Reset(res, req)
+	if h.Handle(&c) || res.statusCode != data.StatusCode || res.Header().Get("Content-Type") != data.ContentType || res.body.String() != data.Message {
+		t.FailNow()
+	}
+	if res.Header().Get("Retry-After") != "1" || res.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.FailNow()
+	}
+	// Other key.
+	req.RemoteAddr = "192.168.1.3:12345"
+	c.Reset(&testResponse{}, req)
+	if !h.Handle(&c) {
+		t.FailNow()
+	}
+	// Recover.
+	time.Sleep(210 * time.Millisecond)
+	req.RemoteAddr = "192.168.1.2:12345"
+	c.Reset(&testResponse{}, req)
+	if !h.Handle(&c) {
+		t.FailNow()
+	}
+}
+
+func Test_RateLimitInterceptor(t *testing.T) {
+	testRateLimitInterceptor(t, &RateLimitInterceptorData{Algorithm: RateLimitTokenBucket})
+	testRateLimitInterceptor(t, &RateLimitInterceptorData{Algorithm: RateLimitSlidingWindow})
+}
+
+func Test_RateLimitInterceptorRedis(t *testing.T) {
+	testRateLimitInterceptor(t, &RateLimitInterceptorData{
+		Algorithm:   RateLimitTokenBucket,
+		Redis:       &redis.ClientConfig{},
+		RedisPrefix: "test:ratelimit:bucket:",
+	})
+	testRateLimitInterceptor(t, &RateLimitInterceptorData{
+		Algorithm:   RateLimitSlidingWindow,
+		Redis:       &redis.ClientConfig{},
+		RedisPrefix: "test:ratelimit:window:",
+	})
+}
+
+func Test_SlidingWindowResult(t *testing.T) {
+	// Previous window 10,current window 0,half elapsed,count is 5.
+	r := slidingWindowResult(false, 5, time.Second, 500*time.Millisecond, 0, 10)
+	if r.remaining != 0 || r.retryAfter != 500*time.Millisecond {
+		t.FailNow()
+	}
+	// Previous window 10,current window 2,elapsed 0.5s,count is 7,wait until count < 5,elapsed 0.7s.
+	r = slidingWindowResult(false, 5, time.Second, 500*time.Millisecond, 2, 10)
+	if r.retryAfter != 200*time.Millisecond {
+		t.Fatal(r.retryAfter)
+	}
+}
+
+func Test_RateLimitInterceptorKey(t *testing.T) {
+	h, err := NewRateLimitInterceptor(&RateLimitInterceptorData{Key: "token", Limit: 1, Period: 60000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	call := func(ip, subject string) bool {
+		req := &http.Request{RemoteAddr: ip + ":12345", Header: http.Header{"Authorization": {"Bearer " + ip + subject}}}
+		var c Context
+		c.Reset(&testResponse{}, req)
+		if subject != "" {
+			c.Data = NewIdentity(map[string]interface{}{"sub": subject})
+		}
+		return h.Handle(&c)
+	}
+	// Identity,different ip.
+	if !call("192.168.1.2", "a") || call("192.168.1.3", "a") || !call("192.168.1.3", "b") {
+		t.FailNow()
+	}
+	// No identity,limited by ip,raw token is not used.
+	if !call("192.168.1.4", "") || call("192.168.1.4", "") {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// Upstream response in response chain.
+// Response handlers can modify StatusCode,Header and Body before it's written to client.
+type Response struct {
+	*http.Response
+}
+
+// Read whole body up to max bytes and replace Body with the buffered one,
+// so that next handlers and forwarder can read it again.
+// Return error if body is bigger than max.
+func (r *Response) ReadBody(max int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := newReplayBody(r.Body, int(max))
+	if err != nil {
+		return nil, err
+	}
+	if !body.Replayable() {
+		// Keep unread part for client.
+		r.Body = readCloser{body.Body(), r.Body}
+		return nil, errors.New("response body is too large")
+	}
+	r.Body.Close()
+	r.Body = body.Body()
+	return body.data, nil
+}
+
+// Replace body,and set "Content-Length".
+func (r *Response) SetBody(data []byte) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+	r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+}
+
+// Replace body with a stream which reads the old body,like a rewriting reader.
+// Body length is unknown,and response is flushed to client immediately.
+// Closing new body closes the old one.
+func (r *Response) WrapBody(f func(io.Reader) io.Reader) {
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	r.Body = readCloser{f(body), body}
+	r.ContentLength = -1
+	r.Header.Del("Content-Length")
+}
+
+// Read from Reader,close Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Set response chain,it runs after upstream response is received.
+// Host calls it after route is matched.
+func (c *Context) SetResponseChain(chain []Handler) {
+	c.responseChain = chain
+}
+
+// Run response chain,return the response to write.
+func (c *Context) handleResponse(response *http.Response) *http.Response {
+	if len(c.responseChain) < 1 {
+		return response
+	}
+	removeHopHeaders(response.Header)
+	c.Response = &Response{Response: response}
+	for _, h := range c.responseChain {
+		if !h.Handle(c) {
+			break
+		}
+	}
+	return c.Response.Response
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// ResponseRewriter register name.
+	responseRewriterRegisterName = HandlerName(&ResponseRewriter{})
+)
+
+func init() {
+	// Register ResponseRewriter.
+	RegisterHandler(responseRewriterRegisterName, NewResponseRewriter)
+}
+
+// Get ResponseRewriter register name.
+func ResponseRewriterRegisterName() string {
+	return responseRewriterRegisterName
+}
+
+// A response Handler that rewrites upstream response headers and body,use it in route response chain.
+type ResponseRewriter struct {
+	// Value is *responseRewritePolicy,replaced by Update.
+	policy atomic.Value
+}
+
+// Compiled ResponseRewriterData.
+type responseRewritePolicy struct {
+	// Headers to remove,like "Server".
+	removeHeader []string
+	// Headers to set.
+	setHeader map[string]string
+	// Replace upstream response of these status codes.
+	errorPage map[int]*InterceptData
+	// Body replacements.
+	replace []ResponseReplaceData
+	// Body content types can be replaced,prefix match.
+	contentType []string
+	// Max body bytes to replace.
+	maxBodySize int64
+}
+
+func (h *ResponseRewriter) Release() {
+}
+
+func (h *ResponseRewriter) Handle(c *Context) bool {
+	res := c.Response
+	if res == nil {
+		// Not in response chain.
+		return true
+	}
+	p := h.policy.Load().(*responseRewritePolicy)
+	for _, k := range p.removeHeader {
+		res.Header.Del(k)
+	}
+	for k, v := range p.setHeader {
+		res.Header.Set(k, v)
+	}
+	// Error page.
+	if page, ok := p.errorPage[res.StatusCode]; ok {
+		if page.StatusCode != 0 {
+			res.StatusCode = page.StatusCode
+		}
+		res.Header.Del("Content-Encoding")
+		res.Header.Set("Content-Type", page.ContentType)
+		res.SetBody([]byte(page.Message))
+		return true
+	}
+	if len(p.replace) < 1 || res.Header.Get("Content-Encoding") != "" || !p.replaceable(res.Header.Get("Content-Type")) {
+		return true
+	}
+	// Body.
+	body, err := res.ReadBody(p.maxBodySize)
+	if err != nil {
+		logError(err)
+		return true
+	}
+	for _, r := range p.replace {
+		body = bytes.Replace(body, []byte(r.Old), []byte(r.New), -1)
+	}
+	res.SetBody(body)
+	return true
+}
+
+func (p *responseRewritePolicy) replaceable(contentType string) bool {
+	for _, s := range p.contentType {
+		if strings.HasPrefix(contentType, s) {
+			return true
+		}
+	}
+	return false
+}
+
+type ResponseReplaceData struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type ResponseRewriterData struct {
+	// Headers to remove,like "Server".
+	RemoveHeader []string `json:"removeHeader"`
+	// Headers to set.
+	SetHeader map[string]string `json:"setHeader"`
+	// Replace upstream response of these status codes,key is status code.
+	// Status code 0 means keep upstream status code.
+	ErrorPage map[int]*InterceptData `json:"errorPage"`
+	// Body replacements,in order.
+	Replace []*ResponseReplaceData `json:"replace"`
+	// Body content types can be replaced,prefix match,default is "text/","application/json".
+	ContentType []string `json:"contentType"`
+	// Max body bytes to replace,bigger body is not replaced,default is 1048576.
+	MaxBodySize int64 `json:"maxBodySize"`
+}
+
+// Update ResponseRewriter,data is *ResponseRewriterData.
+// It's safe to update while handling requests.
+func (h *ResponseRewriter) Update(data interface{}) error {
+	d, ok := data.(*ResponseRewriterData)
+	if !ok {
+		return errors.New(`data must be "*ResponseRewriterData" type`)
+	}
+	p := new(responseRewritePolicy)
+	p.removeHeader = append(p.removeHeader, d.RemoveHeader...)
+	p.setHeader = make(map[string]string)
+	for k, v := range d.SetHeader {
+		p.setHeader[k] = v
+	}
+	p.errorPage = make(map[int]*InterceptData)
+	for k, v := range d.ErrorPage {
+		if v == nil {
+			return fmt.Errorf("error page %d is nil", k)
+		}
+		page := *v
+		if page.ContentType == "" {
+			page.ContentType = "text/html; charset=utf-8"
+		}
+		p.errorPage[k] = &page
+	}
+	for i, r := range d.Replace {
+		if r == nil || r.Old == "" {
+			return fmt.Errorf(`replace %d "old" must be defined`, i)
+		}
+		p.replace = append(p.replace, *r)
+	}
+	p.contentType = append(p.contentType, d.ContentType...)
+	if len(p.contentType) < 1 {
+		p.contentType = []string{"text/", "application/json"}
+	}
+	p.maxBodySize = d.MaxBodySize
+	if p.maxBodySize < 1 {
+		p.maxBodySize = 1024 * 1024
+	}
+	h.policy.Store(p)
+	return nil
+}
+
+// Create a new ResponseRewriter
+func NewResponseRewriter(data interface{}) (Handler, error) {
+	var d *ResponseRewriterData
+	switch v := data.(type) {
+	case *ResponseRewriterData:
+		d = v
+	case string:
+		d = new(ResponseRewriterData)
+		err := json.Unmarshal([]byte(v), d)
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		d = new(ResponseRewriterData)
+		err := Map2Struct(v, d)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
+	}
+	h := new(ResponseRewriter)
+	err := h.Update(d)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_ResponseRewriter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Server", "upstream/1.0")
+		switch r.URL.Path {
+		case "/error":
+			rw.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(rw, "stack trace")
+		case "/binary":
+			rw.Header().Set("Content-Type", "application/octet-stream")
+			io.WriteString(rw, "http://internal:8080/a")
+		default:
+			rw.Header().Set("Content-Type", "application/json")
+			io.WriteString(rw, `{"next":"http://internal:8080/a"}`)
+		}
+	}))
+	defer server.Close()
+	forwarder, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		Upstream: []*UpstreamData{{Url: server.URL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer forwarder.Release()
+	rewriter, err := NewResponseRewriter(map[string]interface{}{
+		"removeHeader": []interface{}{"Server"},
+		"setHeader":    map[string]interface{}{"X-Frame-Options": "DENY"},
+		"errorPage":    map[string]interface{}{"500": map[string]interface{}{"statusCode": 502, "message": "error"}},
+		"replace":      []interface{}{map[string]interface{}{"old": "http://internal:8080", "new": "https://api.example.com"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rewriter.Release()
+	call := func(path string) *testResponse {
+		req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c Context
+		res := new(testResponse)
+		c.Reset(res, req)
+		c.SetResponseChain([]Handler{rewriter})
+		forwarder.Handle(&c)
+		return res
+	}
+	// Body replaced.
+	res := call("/")
+	if res.statusCode != http.StatusOK || res.body.String() != `{"next":"https://api.example.com/a"}` ||
+		res.Header().Get("Server") != "" || res.Header().Get("X-Frame-Options") != "DENY" ||
+		res.Header().Get("Content-Length") != "36" {
+		t.Fatal(res.body.String())
+	}
+	// Error page.
+	res = call("/error")
+	if res.statusCode != http.StatusBadGateway || res.body.String() != "error" {
+		t.FailNow()
+	}
+	// Content type not replaceable.
+	res = call("/binary")
+	if res.body.String() != "http://internal:8080/a" {
+		t.FailNow()
+	}
+	// Rejected update keeps current policy.
+	err = rewriter.Update(&ResponseRewriterData{
+		SetHeader: map[string]string{"X-Frame-Options": "SAMEORIGIN"},
+		Replace:   []*ResponseReplaceData{{New: "a"}},
+	})
+	if err == nil {
+		t.FailNow()
+	}
+	res = call("/")
+	if res.Header().Get("X-Frame-Options") != "DENY" || res.body.String() != `{"next":"https://api.example.com/a"}` {
+		t.FailNow()
+	}
+	err = rewriter.Update(&ResponseRewriterData{SetHeader: map[string]string{"X-Frame-Options": "SAMEORIGIN"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = call("/")
+	if res.Header().Get("X-Frame-Options") != "SAMEORIGIN" || res.body.String() != `{"next":"http://internal:8080/a"}` {
+		t.FailNow()
+	}
+	// Not in response chain.
+	var c Context
+	if !rewriter.Handle(&c) {
+		t.FailNow()
+	}
+}
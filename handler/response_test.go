@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testResponseWrapper(body string) *Response {
+	return &Response{Response: &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Length": {"5"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}}
+}
+
+func Test_Response(t *testing.T) {
+	// Buffered.
+	res := testResponseWrapper("hello")
+	data, err := res.ReadBody(5)
+	if err != nil || string(data) != "hello" {
+		t.FailNow()
+	}
+	data, _ = ioutil.ReadAll(res.Body)
+	if string(data) != "hello" {
+		t.FailNow()
+	}
+	res.SetBody([]byte("hi"))
+	data, _ = ioutil.ReadAll(res.Body)
+	if string(data) != "hi" || res.ContentLength != 2 || res.Header.Get("Content-Length") != "2" {
+		t.FailNow()
+	}
+	// Too large,body is kept.
+	res = testResponseWrapper("hello")
+	_, err = res.ReadBody(3)
+	if err == nil {
+		t.FailNow()
+	}
+	data, _ = ioutil.ReadAll(res.Body)
+	if string(data) != "hello" {
+		t.FailNow()
+	}
+	// Streaming.
+	res = testResponseWrapper("hello")
+	res.WrapBody(func(r io.Reader) io.Reader {
+		return io.MultiReader(strings.NewReader("<"), r, strings.NewReader(">"))
+	})
+	var buf bytes.Buffer
+	io.Copy(&buf, res.Body)
+	if buf.String() != "<hello>" || res.ContentLength != -1 || res.Header.Get("Content-Length") != "" {
+		t.FailNow()
+	}
+	if res.Body.Close() != nil {
+		t.FailNow()
+	}
+}
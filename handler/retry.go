@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Forward retry initial data.
+type RetryData struct {
+	// Max attempts,including the first one.
+	// If it's less than 2,don't retry.
+	Attempts int `json:"attempts"`
+	// Request methods can retry,default is idempotent methods "GET","HEAD","OPTIONS","PUT","DELETE","TRACE".
+	Method []string `json:"method"`
+	// Upstream response status codes will retry,default is 502,503,504.
+	StatusCode []int `json:"statusCode"`
+	// Forward errors will retry,"connect","timeout","reset","tls" or "other",default is "connect","reset".
+	Error []string `json:"error"`
+	// Base backoff,millisecond,default is 25.
+	// Backoff grows exponentially with full jitter.
+	Backoff int `json:"backoff"`
+	// Max backoff,millisecond,default is 250.
+	MaxBackoff int `json:"maxBackoff"`
+	// Retries can't exceed this percent of requests,default is 20.
+	Budget int `json:"budget"`
+	// Retries per second always allowed besides budget,default is 3.
+	MinRetries int `json:"minRetries"`
+	// Max request body bytes to buffer for replay,default is 65536.
+	// Request which body is bigger than it won't retry.
+	MaxBodySize int `json:"maxBodySize"`
+}
+
+// Compiled RetryData.
+type retryPolicy struct {
+	attempts    int
+	method      map[string]int
+	statusCode  map[int]int
+	error       map[string]int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	maxBodySize int
+	budget      *retryBudget
+}
+
+func newRetryPolicy(d *RetryData) *retryPolicy {
+	if d.Attempts < 2 {
+		return nil
+	}
+	p := new(retryPolicy)
+	p.attempts = d.Attempts
+	p.method = make(map[string]int)
+	method := d.Method
+	if len(method) < 1 {
+		method = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace}
+	}
+	for _, s := range method {
+		p.method[strings.ToUpper(s)] = 1
+	}
+	p.statusCode = make(map[int]int)
+	statusCode := d.StatusCode
+	if len(statusCode) < 1 {
+		statusCode = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	for _, n := range statusCode {
+		p.statusCode[n] = 1
+	}
+	p.error = make(map[string]int)
+	errs := d.Error
+	if len(errs) < 1 {
+		errs = []string{ForwardErrorConnect, ForwardErrorReset}
+	}
+	for _, s := range errs {
+		p.error[s] = 1
+	}
+	p.backoff = time.Duration(d.Backoff) * time.Millisecond
+	if p.backoff < 1 {
+		p.backoff = 25 * time.Millisecond
+	}
+	p.maxBackoff = time.Duration(d.MaxBackoff) * time.Millisecond
+	if p.maxBackoff < p.backoff {
+		p.maxBackoff = 10 * p.backoff
+	}
+	p.maxBodySize = d.MaxBodySize
+	if p.maxBodySize < 1 {
+		p.maxBodySize = 64 * 1024
+	}
+	budget := d.Budget
+	if budget < 1 {
+		budget = 20
+	}
+	minRetries := d.MinRetries
+	if minRetries < 1 {
+		minRetries = 3
+	}
+	p.budget = newRetryBudget(float64(budget)/100, minRetries)
+	return p
+}
+
+// Return true if error or status code can retry and budget is enough.
+// Arg attempt begins with 1.
+func (p *retryPolicy) Retry(attempt int, err error, statusCode int) bool {
+	if attempt >= p.attempts {
+		return false
+	}
+	if err != nil {
+		if _, ok := p.error[ForwardErrorClass(err)]; !ok {
+			return false
+		}
+	} else if _, ok := p.statusCode[statusCode]; !ok {
+		return false
+	}
+	return p.budget.Withdraw()
+}
+
+// Sleep before retry,return false if request was canceled.
+// Arg attempt begins with 1.
+func (p *retryPolicy) Backoff(ctx context.Context, attempt int) bool {
+	d := p.backoff << uint(attempt-1)
+	if d > p.maxBackoff || d <= 0 {
+		d = p.maxBackoff
+	}
+	// Full jitter.
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(d)) + 1))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Limit retries to a ratio of requests.
+type retryBudget struct {
+	sync.Mutex
+	// Tokens deposit per request.
+	ratio float64
+	// Tokens deposit per second.
+	minRetries int
+	// Current tokens.
+	tokens float64
+	// Max tokens.
+	maxTokens float64
+	// Last time deposit minRetries.
+	last time.Time
+}
+
+func newRetryBudget(ratio float64, minRetries int) *retryBudget {
+	b := new(retryBudget)
+	b.ratio = ratio
+	b.minRetries = minRetries
+	b.maxTokens = float64(minRetries) + 100*ratio
+	b.tokens = float64(minRetries)
+	b.last = time.Now()
+	return b
+}
+
+// Call for every request.
+func (b *retryBudget) Deposit() {
+	b.Lock()
+	b.deposit(b.ratio)
+	b.Unlock()
+}
+
+// Return true if retry is allowed.
+func (b *retryBudget) Withdraw() bool {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	b.deposit(now.Sub(b.last).Seconds() * float64(b.minRetries))
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *retryBudget) deposit(n float64) {
+	b.tokens += n
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// Request body which can be replayed.
+type replayBody struct {
+	// Buffered body.
+	data []byte
+	// If body is bigger than max size,the rest of body,can't replay.
+	rest io.Reader
+}
+
+// Read body up to max bytes.
+func newReplayBody(body io.Reader, max int) (*replayBody, error) {
+	b := new(replayBody)
+	if body == nil || body == http.NoBody {
+		return b, nil
+	}
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, io.LimitReader(body, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	b.data = buf.Bytes()
+	if len(b.data) > max {
+		b.rest = body
+	}
+	return b, nil
+}
+
+// Return true if body was fully buffered.
+func (b *replayBody) Replayable() bool {
+	return b.rest == nil
+}
+
+// Return a new reader of body.
+func (b *replayBody) Body() io.ReadCloser {
+	if b.rest != nil {
+		return ioutil.NopCloser(io.MultiReader(bytes.NewReader(b.data), b.rest))
+	}
+	if len(b.data) < 1 {
+		return http.NoBody
+	}
+	return ioutil.NopCloser(bytes.NewReader(b.data))
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_DefaultForwarderRetry(t *testing.T) {
+	var badCount, goodCount int32
+	bad := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&badCount, 1)
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&goodCount, 1)
+		io.Copy(rw, r.Body)
+	}))
+	defer good.Close()
+	h, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		Upstream: []*UpstreamData{{Url: bad.URL}, {Url: good.URL}},
+		Retry:    &RetryData{Attempts: 2, Backoff: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(method, body string) *testResponse {
+		var c Context
+		c.Req, err = http.NewRequest(method, "http://127.0.0.1/service1", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Req.Body = ioutil.NopCloser(c.Req.Body)
+		res := new(testResponse)
+		c.Res = res
+		h.Handle(&c)
+		return res
+	}
+	// Retry on different upstream and replay body.
+	for i := 0; i < 2; i++ {
+		res := call(http.MethodPut, "body")
+		if res.statusCode != http.StatusOK || res.body.String() != "body" {
+			t.FailNow()
+		}
+	}
+	if atomic.LoadInt32(&badCount) != 1 || atomic.LoadInt32(&goodCount) != 2 {
+		t.FailNow()
+	}
+	// POST is not idempotent.
+	for i := 0; i < 2; i++ {
+		call(http.MethodPost, "body")
+	}
+	if atomic.LoadInt32(&badCount) != 2 || atomic.LoadInt32(&goodCount) != 3 {
+		t.FailNow()
+	}
+}
+
+func Test_RetryBudget(t *testing.T) {
+	b := newRetryBudget(0.5, 1)
+	if !b.Withdraw() || b.Withdraw() {
+		t.FailNow()
+	}
+	b.Deposit()
+	b.Deposit()
+	if !b.Withdraw() || b.Withdraw() {
+		t.FailNow()
+	}
+}
+
+type testErrorReader struct{}
+
+func (r testErrorReader) Read([]byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func Test_DefaultForwarderRetryWrite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Cancel while backoff.
+		time.AfterFunc(50*time.Millisecond, cancel)
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	h, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		Upstream: []*UpstreamData{{Url: server.URL}},
+		Retry:    &RetryData{Attempts: 2, Backoff: 10000, MaxBackoff: 10000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	// Backoff canceled,write last upstream response.
+	var c Context
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	res := new(testResponse)
+	c.Reset(res, req.WithContext(ctx))
+	h.Handle(&c)
+	if res.statusCode != http.StatusServiceUnavailable {
+		t.Fatal(res.statusCode)
+	}
+	// Read request body failed.
+	req, _ = http.NewRequest(http.MethodPut, "http://127.0.0.1/", ioutil.NopCloser(testErrorReader{}))
+	res = new(testResponse)
+	c.Reset(res, req)
+	if h.Handle(&c) || res.statusCode != http.StatusBadRequest || res.Header().Get("X-Gateway-Error") != "" {
+		t.Fatal(res.statusCode)
+	}
+}
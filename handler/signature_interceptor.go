@@ -0,0 +1,383 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qq51529210/redis"
+)
+
+var (
+	// SignatureInterceptor register name.
+	signatureInterceptorRegisterName = HandlerName(&SignatureInterceptor{})
+)
+
+func init() {
+	// Register SignatureInterceptor.
+	RegisterHandler(signatureInterceptorRegisterName, NewSignatureInterceptor)
+}
+
+// Get SignatureInterceptor register name.
+func SignatureInterceptorRegisterName() string {
+	return signatureInterceptorRegisterName
+}
+
+// Client secret store,return empty string if client is not found.
+type signatureKeyStore interface {
+	Get(client string) (string, error)
+}
+
+// Secrets from configure.
+type staticSignatureKeyStore map[string]string
+
+func (s staticSignatureKeyStore) Get(client string) (string, error) {
+	return s[client], nil
+}
+
+// Secrets in redis hash,field is client,value is secret.
+type redisSignatureKeyStore struct {
+	redis *redis.Client
+	hash  string
+}
+
+func (s *redisSignatureKeyStore) Get(client string) (string, error) {
+	value, err := s.redis.Cmd("HGET", s.hash, client)
+	if err != nil {
+		return "", err
+	}
+	return redisString(value)
+}
+
+// Nonce cache,return false if nonce was used.
+type signatureNonceCache interface {
+	Add(nonce string, ttl time.Duration) (bool, error)
+}
+
+// In-process nonce cache.
+type localSignatureNonceCache struct {
+	sync.Mutex
+	nonce map[string]time.Time
+	// Last time remove expired nonce.
+	sweep time.Time
+}
+
+func (c *localSignatureNonceCache) Add(nonce string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	c.Lock()
+	defer c.Unlock()
+	if now.Sub(c.sweep) > ttl {
+		for k, v := range c.nonce {
+			if now.After(v) {
+				delete(c.nonce, k)
+			}
+		}
+		c.sweep = now
+	}
+	if expire, ok := c.nonce[nonce]; ok && now.Before(expire) {
+		return false, nil
+	}
+	c.nonce[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// Redis nonce cache,use "SET NX PX".
+type redisSignatureNonceCache struct {
+	redis  *redis.Client
+	prefix string
+}
+
+func (c *redisSignatureNonceCache) Add(nonce string, ttl time.Duration) (bool, error) {
+	value, err := c.redis.Cmd("SET", c.prefix+nonce, 1, "NX", "PX", int64(ttl/time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	return value != nil, nil
+}
+
+// A Interceptor that verifies HMAC-SHA256 request signature of server-to-server calls.
+// Signed string is lines of method,path,sorted escaped query,signed headers("name:value"),timestamp,nonce and hex sha256 of body.
+// Client is saved in Context.Data as *Identity.
+type SignatureInterceptor struct {
+	InterceptData
+	// Header names.
+	ClientHeader    string
+	TimestampHeader string
+	NonceHeader     string
+	SignatureHeader string
+	// Other headers to sign,lower case.
+	SignedHeader []string
+	// Max clock skew.
+	MaxSkew time.Duration
+	// Max request body bytes.
+	MaxBodySize int64
+	// Claims forward to upstream,key is claim name,value is header name.
+	ClaimHeader map[string]string
+	// Client secret store.
+	keys signatureKeyStore
+	// Nonce cache.
+	nonce signatureNonceCache
+	// Redis client of keys and nonce.
+	redis *redis.Client
+}
+
+func (h *SignatureInterceptor) Release() {
+	if h.redis != nil {
+		h.redis.Close()
+	}
+}
+
+func (h *SignatureInterceptor) Handle(c *Context) bool {
+	removeIdentityHeader(c.Req.Header, h.ClaimHeader)
+	client, err := h.verify(c.Req, time.Now())
+	if err != nil {
+		h.InterceptData.WriteToResponse(c.Res)
+		return false
+	}
+	id := NewIdentity(map[string]interface{}{"sub": client})
+	id.SetHeader(c.Req.Header, h.ClaimHeader)
+	c.Data = id
+	return true
+}
+
+// Verify request signature,return client.
+func (h *SignatureInterceptor) verify(req *http.Request, now time.Time) (string, error) {
+	client := req.Header.Get(h.ClientHeader)
+	timestamp := req.Header.Get(h.TimestampHeader)
+	nonce := req.Header.Get(h.NonceHeader)
+	signature := signatureDecode(req.Header.Get(h.SignatureHeader))
+	if client == "" || nonce == "" || signature == nil {
+		return "", errors.New("missing signature headers")
+	}
+	// Timestamp.
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	skew := now.Sub(time.Unix(sec, 0))
+	if skew > h.MaxSkew || skew < -h.MaxSkew {
+		return "", errors.New("timestamp is out of range")
+	}
+	// Secret.
+	secret, err := h.keys.Get(client)
+	if err != nil || secret == "" {
+		if err == nil {
+			err = fmt.Errorf(`client "%s" not found`, client)
+		}
+		return "", err
+	}
+	// Body.
+	body, err := signatureBody(req, h.MaxBodySize)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, h.canonical(req, timestamp, nonce, body))
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return "", errors.New("invalid signature")
+	}
+	// Replay.
+	ok, err := h.nonce.Add(client+":"+nonce, 2*h.MaxSkew)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.New("nonce was used")
+	}
+	return client, nil
+}
+
+// Return string to sign.
+func (h *SignatureInterceptor) canonical(req *http.Request, timestamp, nonce string, body []byte) string {
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteByte('\n')
+	b.WriteString(req.URL.EscapedPath())
+	b.WriteByte('\n')
+	// Sorted query,keys and values are escaped,so "&" and "=" in them can't forge other pairs.
+	var pairs []string
+	for k, values := range req.URL.Query() {
+		k = url.QueryEscape(k)
+		for _, v := range values {
+			pairs = append(pairs, k+"="+url.QueryEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	b.WriteString(strings.Join(pairs, "&"))
+	b.WriteByte('\n')
+	for _, k := range h.SignedHeader {
+		b.WriteString(k)
+		b.WriteByte(':')
+		b.WriteString(strings.TrimSpace(req.Header.Get(k)))
+		b.WriteByte('\n')
+	}
+	b.WriteString(timestamp)
+	b.WriteByte('\n')
+	b.WriteString(nonce)
+	b.WriteByte('\n')
+	sum := sha256.Sum256(body)
+	b.WriteString(hex.EncodeToString(sum[:]))
+	return b.String()
+}
+
+// Read body and restore it for forwarder.
+func signatureBody(req *http.Request, max int64) ([]byte, error) {
+	body, err := newReplayBody(req.Body, int(max))
+	if err != nil {
+		return nil, err
+	}
+	if !body.Replayable() {
+		return nil, errors.New("request body is too large")
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	req.Body = body.Body()
+	return body.data, nil
+}
+
+// Decode hex or base64 signature.
+func signatureDecode(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	if data, err := hex.DecodeString(s); err == nil {
+		return data
+	}
+	if data, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return data
+	}
+	return nil
+}
+
+type SignatureInterceptorData struct {
+	InterceptData
+	// Client id header,default is "X-Signature-Client".
+	ClientHeader string `json:"clientHeader"`
+	// Unix timestamp(second) header,default is "X-Signature-Timestamp".
+	TimestampHeader string `json:"timestampHeader"`
+	// Nonce header,default is "X-Signature-Nonce".
+	NonceHeader string `json:"nonceHeader"`
+	// Hex or base64 signature header,default is "X-Signature".
+	SignatureHeader string `json:"signatureHeader"`
+	// Other headers to sign,like "Content-Type".
+	SignedHeader []string `json:"signedHeader"`
+	// Max clock skew,millisecond,default is 300000.
+	MaxSkew int `json:"maxSkew"`
+	// Max request body bytes,default is 1048576.
+	MaxBodySize int64 `json:"maxBodySize"`
+	// Client secrets,key is client id.
+	Key map[string]string `json:"key"`
+	// Redis for client secrets(if "key" is empty) and nonce cache.
+	Redis *redis.ClientConfig `json:"redis"`
+	// Redis hash of client secrets,default is "gateway:signature:key".
+	RedisHash string `json:"redisHash"`
+	// Redis nonce key prefix,default is "gateway:signature:nonce:".
+	RedisNoncePrefix string `json:"redisNoncePrefix"`
+	// Claims forward to upstream,key is claim name,value is header name,
+	// like {"sub": "X-Client-Id"}.
+	ClaimHeader map[string]string `json:"claimHeader"`
+}
+
+func (h *SignatureInterceptor) Update(data interface{}) error {
+	d, ok := data.(*SignatureInterceptorData)
+	if !ok {
+		return errors.New(`data must be "*SignatureInterceptorData" type`)
+	}
+	if d.Key == nil && d.Redis == nil {
+		return errors.New(`"key" or "redis" must be defined`)
+	}
+	if h.redis != nil {
+		h.redis.Close()
+		h.redis = nil
+	}
+	// key and nonce
+	if d.Redis != nil {
+		h.redis = redis.NewClient(nil, d.Redis)
+		prefix := d.RedisNoncePrefix
+		if prefix == "" {
+			prefix = "gateway:signature:nonce:"
+		}
+		h.nonce = &redisSignatureNonceCache{redis: h.redis, prefix: prefix}
+	} else {
+		h.nonce = &localSignatureNonceCache{nonce: make(map[string]time.Time), sweep: time.Now()}
+	}
+	if d.Key != nil {
+		h.keys = staticSignatureKeyStore(d.Key)
+	} else {
+		hash := d.RedisHash
+		if hash == "" {
+			hash = "gateway:signature:key"
+		}
+		h.keys = &redisSignatureKeyStore{redis: h.redis, hash: hash}
+	}
+	h.InterceptData = d.InterceptData
+	h.InterceptData.Check(http.StatusUnauthorized)
+	h.ClientHeader = signatureDefault(d.ClientHeader, "X-Signature-Client")
+	h.TimestampHeader = signatureDefault(d.TimestampHeader, "X-Signature-Timestamp")
+	h.NonceHeader = signatureDefault(d.NonceHeader, "X-Signature-Nonce")
+	h.SignatureHeader = signatureDefault(d.SignatureHeader, "X-Signature")
+	h.SignedHeader = make([]string, 0, len(d.SignedHeader))
+	for _, s := range d.SignedHeader {
+		h.SignedHeader = append(h.SignedHeader, strings.ToLower(s))
+	}
+	h.MaxSkew = time.Duration(d.MaxSkew) * time.Millisecond
+	if h.MaxSkew < 1 {
+		h.MaxSkew = 5 * time.Minute
+	}
+	h.MaxBodySize = d.MaxBodySize
+	if h.MaxBodySize < 1 {
+		h.MaxBodySize = 1024 * 1024
+	}
+	h.ClaimHeader = d.ClaimHeader
+	return nil
+}
+
+func signatureDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// Create a new SignatureInterceptor
+func NewSignatureInterceptor(data interface{}) (Handler, error) {
+	var d *SignatureInterceptorData
+	switch v := data.(type) {
+	case *SignatureInterceptorData:
+		d = v
+	case string:
+		d = new(SignatureInterceptorData)
+		err := json.Unmarshal([]byte(v), d)
+		if err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		d = new(SignatureInterceptorData)
+		err := Map2Struct(v, d)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid data type %s", reflect.TypeOf(data))
+	}
+	h := new(SignatureInterceptor)
+	err := h.Update(d)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSignatureRequest(t *testing.T, h *SignatureInterceptor, secret, nonce string, ts time.Time, body string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1/orders?b=2&a=1", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature-Client", "billing")
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature-Nonce", nonce)
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, h.canonical(req, timestamp, nonce, []byte(body)))
+	req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func Test_SignatureInterceptor(t *testing.T) {
+	hd, err := NewSignatureInterceptor(map[string]interface{}{
+		"key":          map[string]interface{}{"billing": "secret"},
+		"signedHeader": []interface{}{"Content-Type"},
+		"maxSkew":      60000,
+		"maxBodySize":  16,
+		"claimHeader":  map[string]interface{}{"sub": "X-Client-Id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hd.Release()
+	h := hd.(*SignatureInterceptor)
+	// Canonical string.
+	req := testSignatureRequest(t, h, "secret", "n1", time.Unix(100, 0), "{}")
+	if h.canonical(req, "100", "n1", []byte("{}")) != "POST\n/orders\na=1&b=2\ncontent-type:application/json\n100\nn1\n"+
+		"44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a" {
+		t.FailNow()
+	}
+	// Escaped query can't forge other pairs.
+	req1, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/x?a=1&b=2", nil)
+	req2, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/x?a=1%26b%3D2", nil)
+	if h.canonical(req1, "100", "n1", nil) == h.canonical(req2, "100", "n1", nil) {
+		t.FailNow()
+	}
+	// Ok,body can be read again.
+	req = testSignatureRequest(t, h, "secret", "n1", time.Now(), "{}")
+	req.Header.Set("X-Client-Id", "admin")
+	c, res := testHandle(h, "", req)
+	if res.statusCode != 0 || c.Identity().Subject != "billing" || req.Header.Get("X-Client-Id") != "billing" {
+		t.FailNow()
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != "{}" {
+		t.FailNow()
+	}
+	// Replay.
+	_, res = testHandle(h, "", testSignatureRequest(t, h, "secret", "n1", time.Now(), "{}"))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	// Wrong secret.
+	_, res = testHandle(h, "", testSignatureRequest(t, h, "other", "n2", time.Now(), "{}"))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	// Tampered body.
+	req = testSignatureRequest(t, h, "secret", "n3", time.Now(), "{}")
+	req.Body = ioutil.NopCloser(strings.NewReader(`{"a":1}`))
+	req.Header.Set("X-Client-Id", "admin")
+	_, res = testHandle(h, "", req)
+	if res.statusCode != http.StatusUnauthorized || req.Header.Get("X-Client-Id") != "" {
+		t.FailNow()
+	}
+	// Tampered query,signed "a=1&b=2".
+	req = testSignatureRequest(t, h, "secret", "n7", time.Now(), "{}")
+	req.URL.RawQuery = "a=1%26b%3D2"
+	_, res = testHandle(h, "", req)
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	// Expired timestamp.
+	_, res = testHandle(h, "", testSignatureRequest(t, h, "secret", "n4", time.Now().Add(-2*time.Minute), "{}"))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	// Body too large.
+	_, res = testHandle(h, "", testSignatureRequest(t, h, "secret", "n5", time.Now(), strings.Repeat("a", 17)))
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+	// Unknown client.
+	req = testSignatureRequest(t, h, "secret", "n6", time.Now(), "{}")
+	req.Header.Set("X-Signature-Client", "other")
+	_, res = testHandle(h, "", req)
+	if res.statusCode != http.StatusUnauthorized {
+		t.FailNow()
+	}
+}
+
+func Test_LocalSignatureNonceCache(t *testing.T) {
+	c := &localSignatureNonceCache{nonce: make(map[string]time.Time)}
+	ok1, _ := c.Add("a", 20*time.Millisecond)
+	ok2, _ := c.Add("a", 20*time.Millisecond)
+	if !ok1 || ok2 {
+		t.FailNow()
+	}
+	time.Sleep(30 * time.Millisecond)
+	ok1, _ = c.Add("a", 20*time.Millisecond)
+	if !ok1 || len(c.nonce) != 1 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Return flush interval of response.
+// Server-Sent Events and body without length will be flushed immediately.
+func (h *DefaultForwarder) flushInterval(response *http.Response) time.Duration {
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" || response.ContentLength == -1 {
+		return -1
+	}
+	return h.FlushInterval
+}
+
+// Copy response body to client and flush by interval.
+// Negative interval means flush after every write,0 means don't flush.
+func copyResponse(res http.ResponseWriter, body io.Reader, interval time.Duration) error {
+	flusher, ok := res.(http.Flusher)
+	if !ok || interval == 0 {
+		_, err := io.Copy(res, body)
+		return err
+	}
+	w := &flushWriter{res: res, flusher: flusher, interval: interval}
+	defer w.Stop()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			_, werr := w.Write(buf[:n])
+			if werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Flush data to client by interval.
+type flushWriter struct {
+	sync.Mutex
+	res     http.ResponseWriter
+	flusher http.Flusher
+	// Negative value means flush after every write.
+	interval time.Duration
+	// Flush timer,nil means no pending data.
+	timer *time.Timer
+	// Stopped,timer will not be created again.
+	stop bool
+}
+
+func (w *flushWriter) Write(b []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	n, err := w.res.Write(b)
+	if err != nil {
+		return n, err
+	}
+	if w.interval < 0 {
+		w.flusher.Flush()
+		return n, nil
+	}
+	if w.timer == nil && !w.stop {
+		w.timer = time.AfterFunc(w.interval, w.flush)
+	}
+	return n, nil
+}
+
+func (w *flushWriter) flush() {
+	w.Lock()
+	defer w.Unlock()
+	if w.stop {
+		return
+	}
+	w.flusher.Flush()
+	w.timer = nil
+}
+
+// Stop flush timer.
+// It must be called before handler returned,response can't be used after that.
+func (w *flushWriter) Stop() {
+	w.Lock()
+	defer w.Unlock()
+	w.stop = true
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testStreamGateway(t *testing.T, upstream string) (*httptest.Server, Handler) {
+	h, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		RequestUrl: upstream,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var c Context
+		c.Reset(rw, r)
+		h.Handle(&c)
+	}))
+	return gw, h
+}
+
+func Test_DefaultForwarderEventStream(t *testing.T) {
+	done := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Content-Length", "100")
+		io.WriteString(rw, "data: 1\n\n")
+		rw.(http.Flusher).Flush()
+		<-done
+	}))
+	defer upstream.Close()
+	gw, h := testStreamGateway(t, upstream.URL)
+	defer gw.Close()
+	defer h.Release()
+	defer close(done)
+	res, err := http.Get(gw.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	// Event arrives before upstream finished.
+	line := make(chan string, 1)
+	go func() {
+		s, _ := bufio.NewReader(res.Body).ReadString('\n')
+		line <- s
+	}()
+	select {
+	case s := <-line:
+		if s != "data: 1\n" {
+			t.Fatal(s)
+		}
+	case <-time.After(time.Second):
+		t.FailNow()
+	}
+}
+
+func Test_DefaultForwarderTrailer(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Trailer", "X-Checksum")
+		io.WriteString(rw, "body")
+		rw.(http.Flusher).Flush()
+		rw.Header().Set("X-Checksum", "123")
+		rw.Header().Set(http.TrailerPrefix+"X-Undeclared", "456")
+	}))
+	defer upstream.Close()
+	gw, h := testStreamGateway(t, upstream.URL)
+	defer gw.Close()
+	defer h.Release()
+	res, err := http.Get(gw.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil || string(body) != "body" {
+		t.FailNow()
+	}
+	if res.Trailer.Get("X-Checksum") != "123" || res.Trailer.Get("X-Undeclared") != "456" {
+		t.Fatal(res.Trailer)
+	}
+}
+
+// Send a signal when flush.
+type testFlushResponse struct {
+	testResponse
+	flush chan struct{}
+}
+
+func (r *testFlushResponse) Flush() {
+	select {
+	case r.flush <- struct{}{}:
+	default:
+	}
+}
+
+func Test_CopyResponseFlushInterval(t *testing.T) {
+	reader, writer := io.Pipe()
+	res := &testFlushResponse{flush: make(chan struct{}, 1)}
+	go func() {
+		writer.Write([]byte("1"))
+		// Flush before body finished.
+		select {
+		case <-res.flush:
+			writer.Close()
+		case <-time.After(time.Second):
+			writer.CloseWithError(io.ErrUnexpectedEOF)
+		}
+	}()
+	err := copyResponse(res, reader, 20*time.Millisecond)
+	if err != nil || res.body.String() != "1" {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// Upstream TLS initial data.
+type TLSData struct {
+	// CA certificates PEM data use for verifying upstream certificate.
+	// If it's empty,use system roots.
+	CAPEM string `json:"caPEM"`
+	// Client certificate PEM data for mTLS.
+	X509CertPEM string `json:"x509CertPEM"`
+	// Client key PEM data for mTLS.
+	X509KeyPEM string `json:"x509KeyPEM"`
+	// Server name for SNI and certificate verification.
+	// If it's empty,use host of upstream url.
+	ServerName string `json:"serverName"`
+	// Minimum TLS version,"1.0","1.1","1.2" or "1.3",default is "1.2".
+	MinVersion string `json:"minVersion"`
+	// Don't verify upstream certificate,only use for development.
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+}
+
+var tlsVersion = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Create a new tls.Config.
+func NewTLSConfig(d *TLSData) (*tls.Config, error) {
+	cfg := new(tls.Config)
+	// caPEM
+	if d.CAPEM != "" {
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM([]byte(d.CAPEM)) {
+			return nil, errors.New(`"tls"."caPEM" no certificate found`)
+		}
+	}
+	// x509CertPEM and x509KeyPEM
+	if d.X509CertPEM != "" || d.X509KeyPEM != "" {
+		certificate, err := tls.X509KeyPair([]byte(d.X509CertPEM), []byte(d.X509KeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf(`"tls" %s`, err.Error())
+		}
+		cfg.Certificates = []tls.Certificate{certificate}
+	}
+	// minVersion
+	if d.MinVersion == "" {
+		cfg.MinVersion = tls.VersionTLS12
+	} else {
+		version, ok := tlsVersion[d.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf(`"tls"."minVersion" invalid value "%s"`, d.MinVersion)
+		}
+		cfg.MinVersion = version
+	}
+	cfg.ServerName = d.ServerName
+	cfg.InsecureSkipVerify = d.InsecureSkipVerify
+	return cfg, nil
+}
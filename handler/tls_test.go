@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Return PEM of the test server certificate.
+func testServerCertPEM(ser *httptest.Server) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ser.Certificate().Raw}))
+}
+
+func testTLSForward(h Handler) int {
+	var c Context
+	c.Req, _ = http.NewRequest(http.MethodGet, "http://127.0.0.1/service1", nil)
+	res := new(testResponse)
+	c.Res = res
+	h.Handle(&c)
+	return res.statusCode
+}
+
+func Test_NewTLSConfig(t *testing.T) {
+	cfg, err := NewTLSConfig(&TLSData{ServerName: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 || cfg.ServerName != "example.com" || cfg.RootCAs != nil {
+		t.FailNow()
+	}
+	_, err = NewTLSConfig(&TLSData{MinVersion: "1.4"})
+	if err == nil {
+		t.FailNow()
+	}
+	_, err = NewTLSConfig(&TLSData{CAPEM: "bad pem"})
+	if err == nil {
+		t.FailNow()
+	}
+	_, err = NewTLSConfig(&TLSData{X509CertPEM: "bad pem"})
+	if err == nil {
+		t.FailNow()
+	}
+}
+
+func Test_DefaultForwarderTLS(t *testing.T) {
+	ser := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer ser.Close()
+	// Unknown CA.
+	h, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		RequestUrl: ser.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	if testTLSForward(h) != http.StatusBadGateway {
+		t.FailNow()
+	}
+	// Trust CA,keep other transport settings.
+	err = h.Update(&NewDefaultForwarderData{
+		Transport: &TransportData{MaxIdleConnsPerHost: 4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Update(&NewDefaultForwarderData{
+		TLS: &TLSData{CAPEM: testServerCertPEM(ser)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.(*DefaultForwarder).ownTransport.MaxIdleConnsPerHost != 4 {
+		t.FailNow()
+	}
+	if testTLSForward(h) != http.StatusOK {
+		t.FailNow()
+	}
+	// Can't use with shared transport.
+	err = h.Update(&NewDefaultForwarderData{
+		TransportName: "test-tls",
+		TLS:           &TLSData{},
+	})
+	if err == nil {
+		t.FailNow()
+	}
+}
+
+func Test_DefaultForwarderMTLS(t *testing.T) {
+	ser := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) < 1 {
+			rw.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	ser.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ser.StartTLS()
+	defer ser.Close()
+	// Without client certificate.
+	caPEM := testServerCertPEM(ser)
+	h, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		RequestUrl: ser.URL,
+		TLS:        &TLSData{CAPEM: caPEM},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	if testTLSForward(h) != http.StatusBadGateway {
+		t.FailNow()
+	}
+	// Use the server certificate as client certificate.
+	key, err := x509.MarshalPKCS8PrivateKey(ser.TLS.Certificates[0].PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Update(&NewDefaultForwarderData{
+		TLS: &TLSData{
+			CAPEM:       caPEM,
+			X509CertPEM: caPEM,
+			X509KeyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testTLSForward(h) != http.StatusOK {
+		t.FailNow()
+	}
+}
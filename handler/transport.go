@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Named shared transports,key is name,value is *switchTransport.
+	sharedTransport sync.Map
+)
+
+// Upstream http transport initial data.
+type TransportData struct {
+	// Max idle connections of all upstreams,default is 100.
+	MaxIdleConns int `json:"maxIdleConns"`
+	// Max idle connections per upstream,default is 32.
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost"`
+	// Max connections per upstream,0 means no limit.
+	MaxConnsPerHost int `json:"maxConnsPerHost"`
+	// How long an idle connection will be closed,millisecond,default is 90000.
+	IdleConnTimeout int `json:"idleConnTimeout"`
+	// Dial timeout,millisecond,default is 30000.
+	DialTimeout int `json:"dialTimeout"`
+	// TCP keep-alive period,millisecond,default is 30000.
+	// Negative value disables TCP keep-alive.
+	KeepAlive int `json:"keepAlive"`
+	// TLS handshake timeout,millisecond,default is 10000.
+	TLSHandshakeTimeout int `json:"tlsHandshakeTimeout"`
+	// How long to wait for upstream response headers,millisecond,0 means no limit.
+	ResponseHeaderTimeout int `json:"responseHeaderTimeout"`
+	// Disable http keep-alive,every request use a new connection.
+	DisableKeepAlives bool `json:"disableKeepAlives"`
+	// Try HTTP/2 to TLS upstream.
+	HTTP2 bool `json:"http2"`
+	// TLS settings for https upstream.
+	TLS *TLSData `json:"tls"`
+}
+
+// Create a new http.Transport,data can be nil.
+func NewTransport(data *TransportData) (*http.Transport, error) {
+	d := new(TransportData)
+	if data != nil {
+		*d = *data
+	}
+	if d.MaxIdleConns < 1 {
+		d.MaxIdleConns = 100
+	}
+	if d.MaxIdleConnsPerHost < 1 {
+		d.MaxIdleConnsPerHost = 32
+	}
+	if d.IdleConnTimeout < 1 {
+		d.IdleConnTimeout = 90000
+	}
+	if d.DialTimeout < 1 {
+		d.DialTimeout = 30000
+	}
+	if d.KeepAlive == 0 {
+		d.KeepAlive = 30000
+	}
+	if d.TLSHandshakeTimeout < 1 {
+		d.TLSHandshakeTimeout = 10000
+	}
+	var tlsConfig *tls.Config
+	if d.TLS != nil {
+		var err error
+		tlsConfig, err = NewTLSConfig(d.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(d.DialTimeout) * time.Millisecond,
+		KeepAlive: time.Duration(d.KeepAlive) * time.Millisecond,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		TLSClientConfig:       tlsConfig,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          d.MaxIdleConns,
+		MaxIdleConnsPerHost:   d.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       d.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(d.IdleConnTimeout) * time.Millisecond,
+		TLSHandshakeTimeout:   time.Duration(d.TLSHandshakeTimeout) * time.Millisecond,
+		ResponseHeaderTimeout: time.Duration(d.ResponseHeaderTimeout) * time.Millisecond,
+		ExpectContinueTimeout: time.Second,
+		DisableKeepAlives:     d.DisableKeepAlives,
+		ForceAttemptHTTP2:     d.HTTP2,
+	}, nil
+}
+
+// Create or replace a named shared transport.
+// Forwarders use it will use the new one.
+func SetTransport(name string, data *TransportData) error {
+	transport, err := NewTransport(data)
+	if err != nil {
+		return fmt.Errorf(`transport "%s" %s`, name, err.Error())
+	}
+	t := new(switchTransport)
+	value, loaded := sharedTransport.LoadOrStore(name, t)
+	if loaded {
+		t = value.(*switchTransport)
+	}
+	old := t.Load()
+	t.Store(transport)
+	if old != nil {
+		old.(*http.Transport).CloseIdleConnections()
+	}
+	return nil
+}
+
+// Return a named shared transport.
+func SharedTransport(name string) (http.RoundTripper, error) {
+	value, ok := sharedTransport.Load(name)
+	if !ok {
+		return nil, fmt.Errorf(`transport "%s" not found`, name)
+	}
+	return value.(*switchTransport), nil
+}
+
+// A http.RoundTripper which can be replaced at runtime.
+type switchTransport struct {
+	// Value is roundTripper,because atomic.Value requires consistent type.
+	value atomic.Value
+}
+
+type roundTripper struct {
+	http.RoundTripper
+}
+
+func (t *switchTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return t.Load().RoundTrip(request)
+}
+
+// Return current http.RoundTripper,or nil.
+func (t *switchTransport) Load() http.RoundTripper {
+	rt, _ := t.value.Load().(roundTripper)
+	return rt.RoundTripper
+}
+
+func (t *switchTransport) Store(rt http.RoundTripper) {
+	t.value.Store(roundTripper{rt})
+}
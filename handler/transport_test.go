@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_NewTransport(t *testing.T) {
+	transport, err := NewTransport(&TransportData{
+		MaxIdleConnsPerHost:   8,
+		ResponseHeaderTimeout: 1000,
+		HTTP2:                 true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.MaxIdleConns != 100 || transport.MaxIdleConnsPerHost != 8 ||
+		transport.IdleConnTimeout != 90*time.Second || transport.ResponseHeaderTimeout != time.Second ||
+		!transport.ForceAttemptHTTP2 {
+		t.FailNow()
+	}
+}
+
+func Test_SharedTransport(t *testing.T) {
+	ser := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer ser.Close()
+	_, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		RequestUrl:    ser.URL,
+		TransportName: "test-shared",
+	})
+	if err == nil {
+		t.FailNow()
+	}
+	err = SetTransport("test-shared", &TransportData{MaxIdleConnsPerHost: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		RequestUrl:    ser.URL,
+		TransportName: "test-shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	shared, _ := SharedTransport("test-shared")
+	if h.(*DefaultForwarder).transport.Load() != shared || h.(*DefaultForwarder).ownTransport != nil {
+		t.FailNow()
+	}
+	// Replace shared transport.
+	err = SetTransport("test-shared", &TransportData{MaxIdleConnsPerHost: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared.(*switchTransport).Load().(*http.Transport).MaxIdleConnsPerHost != 2 {
+		t.FailNow()
+	}
+	var c Context
+	c.Req, _ = http.NewRequest(http.MethodGet, "http://127.0.0.1/service1", nil)
+	res := new(testResponse)
+	c.Res = res
+	if !h.Handle(&c) || res.statusCode != http.StatusOK {
+		t.FailNow()
+	}
+	// Own transport.
+	err = h.Update(&NewDefaultForwarderData{Transport: &TransportData{}, RequestTimeout: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.(*DefaultForwarder).ownTransport == nil || h.(*DefaultForwarder).transport.Load() != h.(*DefaultForwarder).ownTransport {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Return lower case protocol of "Upgrade" header,
+// or empty string if "Connection" header has no "upgrade" token.
+func upgradeType(header http.Header) string {
+	for _, v := range header["Connection"] {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), "upgrade") {
+				return strings.ToLower(header.Get("Upgrade"))
+			}
+		}
+	}
+	return ""
+}
+
+// Hijack client connection and tunnel it with upstream connection,
+// until one side closed or idle timeout.
+// Return false if it can't upgrade.
+func (h *DefaultForwarder) writeUpgrade(c *Context, response *http.Response) bool {
+	upstreamConn, ok := response.Body.(io.ReadWriteCloser)
+	if !ok {
+		response.Body.Close()
+		h.writeError(c, ForwardErrorOther)
+		return false
+	}
+	defer upstreamConn.Close()
+	if upgradeType(c.Req.Header) != upgradeType(response.Header) {
+		h.writeError(c, ForwardErrorOther)
+		return false
+	}
+	hijacker, ok := c.Res.(http.Hijacker)
+	if !ok {
+		h.writeError(c, ForwardErrorOther)
+		return false
+	}
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		h.writeError(c, ForwardErrorOther)
+		return false
+	}
+	defer clientConn.Close()
+	// Write 101 response to client.
+	for k, v := range h.ResponseAdditionHeader {
+		response.Header.Add(k, v)
+	}
+	response.Body = nil
+	err = response.Write(clientBuf)
+	if err == nil {
+		err = clientBuf.Flush()
+	}
+	if err != nil {
+		return true
+	}
+	// Relay data in both directions.
+	t := newUpgradeTunnel(h.UpgradeIdleTimeout, clientConn, upstreamConn)
+	defer t.Stop()
+	errs := make(chan error, 2)
+	// Client may send data which was buffered before hijack.
+	go t.Copy(upstreamConn, clientBuf.Reader, errs)
+	go t.Copy(clientConn, upstreamConn, errs)
+	<-errs
+	return true
+}
+
+// Close both connections of tunnel if there is no data after idle timeout.
+type upgradeTunnel struct {
+	sync.Mutex
+	// Idle timeout,0 means no limit.
+	idle time.Duration
+	// Idle timer.
+	timer *time.Timer
+	// Connections.
+	conn []io.Closer
+}
+
+func newUpgradeTunnel(idle time.Duration, conn ...io.Closer) *upgradeTunnel {
+	t := new(upgradeTunnel)
+	t.idle = idle
+	t.conn = conn
+	if idle > 0 {
+		t.timer = time.AfterFunc(idle, t.close)
+	}
+	return t
+}
+
+func (t *upgradeTunnel) close() {
+	for _, c := range t.conn {
+		c.Close()
+	}
+}
+
+// Reset idle timer.
+func (t *upgradeTunnel) active() {
+	if t.timer == nil {
+		return
+	}
+	t.Lock()
+	t.timer.Reset(t.idle)
+	t.Unlock()
+}
+
+// Stop idle timer.
+func (t *upgradeTunnel) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// Copy data from src to dst,send error to errs when it's done.
+func (t *upgradeTunnel) Copy(dst io.Writer, src io.Reader, errs chan<- error) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			t.active()
+			_, werr := dst.Write(buf[:n])
+			if werr != nil {
+				errs <- werr
+				return
+			}
+		}
+		if err != nil {
+			errs <- err
+			return
+		}
+	}
+}
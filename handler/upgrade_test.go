@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Upstream which switch to "echo" protocol.
+func testUpgradeUpstream() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if upgradeType(r.Header) != "echo" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, buf, err := rw.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		buf.Flush()
+		io.Copy(conn, buf)
+	}))
+}
+
+// Dial gateway and upgrade to "echo" protocol.
+func testUpgradeDial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: " + addr + "\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("X-Test") != "1" {
+		t.Fatal(res.StatusCode)
+	}
+	return conn, reader
+}
+
+func Test_DefaultForwarderUpgrade(t *testing.T) {
+	upstream := testUpgradeUpstream()
+	defer upstream.Close()
+	h, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		RequestUrl:             upstream.URL,
+		RequestTimeout:         100,
+		UpgradeIdleTimeout:     200,
+		ResponseAdditionHeader: map[string]string{"X-Test": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	gw := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var c Context
+		c.Reset(rw, r)
+		h.Handle(&c)
+	}))
+	defer gw.Close()
+	addr := gw.Listener.Addr().String()
+	// Echo,longer than request timeout.
+	conn, reader := testUpgradeDial(t, addr)
+	defer conn.Close()
+	buf := make([]byte, 5)
+	for i := 0; i < 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		_, err = conn.Write([]byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.ReadFull(reader, buf)
+		if err != nil || string(buf) != "hello" {
+			t.FailNow()
+		}
+	}
+	// Idle timeout.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = reader.ReadByte()
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+}
+
+func Test_UpgradeType(t *testing.T) {
+	header := make(http.Header)
+	header.Set("Upgrade", "WebSocket")
+	if upgradeType(header) != "" {
+		t.FailNow()
+	}
+	header.Set("Connection", "keep-alive, Upgrade")
+	if upgradeType(header) != "websocket" {
+		t.FailNow()
+	}
+}
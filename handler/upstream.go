@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// Round-robin,default strategy.
+	BalanceRoundRobin = "roundRobin"
+	// Smooth weighted round-robin.
+	BalanceWeightedRoundRobin = "weightedRoundRobin"
+	// Least active connections.
+	BalanceLeastConn = "leastConn"
+	// Random two choices,pick the one has less active connections.
+	BalanceRandom2 = "random2"
+	// Consistent hashing on HashKey.
+	BalanceHash = "hash"
+)
+
+// Upstream initial data.
+type UpstreamData struct {
+	// Http service url like "http://host".
+	Url string `json:"url"`
+	// Weight of upstream,default is 1.
+	Weight int `json:"weight"`
+}
+
+// A backend http service.
+type Upstream struct {
+	// Service url.
+	Url *url.URL
+	// Weight of upstream.
+	Weight int
+	// Active connections.
+	conn int64
+	// Health state.
+	upstreamHealth
+	// Current weight of smooth weighted round-robin.
+	current int
+}
+
+// Return active connections.
+func (u *Upstream) Conn() int64 {
+	return atomic.LoadInt64(&u.conn)
+}
+
+// Call when forward request begin.
+func (u *Upstream) acquire() {
+	atomic.AddInt64(&u.conn, 1)
+}
+
+// Call when forward request end.
+func (u *Upstream) release() {
+	atomic.AddInt64(&u.conn, -1)
+}
+
+// Select an upstream from pool.
+type Balancer interface {
+	// Return one of upstream for request,upstream is not empty.
+	Next(c *Context, upstream []*Upstream) *Upstream
+}
+
+// Create Balancer by strategy name.
+// Arg hashKey only use for BalanceHash,"ip","header:Name" or "cookie:Name".
+func NewBalancer(strategy, hashKey string) (Balancer, error) {
+	switch strategy {
+	case "", BalanceRoundRobin:
+		return new(roundRobinBalancer), nil
+	case BalanceWeightedRoundRobin:
+		return new(weightedRoundRobinBalancer), nil
+	case BalanceLeastConn:
+		return new(leastConnBalancer), nil
+	case BalanceRandom2:
+		return new(random2Balancer), nil
+	case BalanceHash:
+		b := new(hashBalancer)
+		switch {
+		case hashKey == "ip":
+		case strings.HasPrefix(hashKey, "header:") && len(hashKey) > len("header:"):
+		case strings.HasPrefix(hashKey, "cookie:") && len(hashKey) > len("cookie:"):
+		default:
+			return nil, fmt.Errorf(`"hashKey" invalid value "%s"`, hashKey)
+		}
+		b.key = hashKey
+		return b, nil
+	default:
+		return nil, fmt.Errorf(`"balance" invalid value "%s"`, strategy)
+	}
+}
+
+type roundRobinBalancer struct {
+	n uint64
+}
+
+func (b *roundRobinBalancer) Next(c *Context, upstream []*Upstream) *Upstream {
+	n := atomic.AddUint64(&b.n, 1)
+	return upstream[n%uint64(len(upstream))]
+}
+
+type weightedRoundRobinBalancer struct {
+	sync.Mutex
+}
+
+func (b *weightedRoundRobinBalancer) Next(c *Context, upstream []*Upstream) *Upstream {
+	var best *Upstream
+	total := 0
+	b.Lock()
+	for _, u := range upstream {
+		u.current += u.Weight
+		total += u.Weight
+		if best == nil || u.current > best.current {
+			best = u
+		}
+	}
+	best.current -= total
+	b.Unlock()
+	return best
+}
+
+type leastConnBalancer struct {
+	roundRobinBalancer
+}
+
+func (b *leastConnBalancer) Next(c *Context, upstream []*Upstream) *Upstream {
+	// Start at different index,so that upstreams have same connections take turns.
+	n := int(atomic.AddUint64(&b.n, 1) % uint64(len(upstream)))
+	best := upstream[n]
+	for i := 1; i < len(upstream); i++ {
+		u := upstream[(n+i)%len(upstream)]
+		if u.Conn()*int64(best.Weight) < best.Conn()*int64(u.Weight) {
+			best = u
+		}
+	}
+	return best
+}
+
+type random2Balancer struct {
+}
+
+func (b *random2Balancer) Next(c *Context, upstream []*Upstream) *Upstream {
+	if len(upstream) < 2 {
+		return upstream[0]
+	}
+	i := rand.Intn(len(upstream))
+	j := rand.Intn(len(upstream) - 1)
+	if j >= i {
+		j++
+	}
+	if upstream[j].Conn() < upstream[i].Conn() {
+		return upstream[j]
+	}
+	return upstream[i]
+}
+
+// Weighted rendezvous hashing,only the keys of a removed upstream will be remapped.
+type hashBalancer struct {
+	roundRobinBalancer
+	// "ip","header:Name" or "cookie:Name".
+	key string
+}
+
+func (b *hashBalancer) Next(c *Context, upstream []*Upstream) *Upstream {
+	key := b.hashKey(c)
+	if key == "" {
+		return b.roundRobinBalancer.Next(c, upstream)
+	}
+	var best *Upstream
+	bestScore := 0.0
+	for _, u := range upstream {
+		h := fnv.New64a()
+		h.Write([]byte(u.Url.Host))
+		h.Write([]byte(key))
+		// Map hash to (0,1).
+		f := (float64(h.Sum64()>>11) + 0.5) / (1 << 53)
+		score := -float64(u.Weight) / math.Log(f)
+		if best == nil || score > bestScore {
+			best = u
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func (b *hashBalancer) hashKey(c *Context) string {
+	switch {
+	case b.key == "ip":
+		return c.ClientIP()
+	case strings.HasPrefix(b.key, "header:"):
+		return c.Req.Header.Get(b.key[len("header:"):])
+	default:
+		cookie, err := c.Req.Cookie(b.key[len("cookie:"):])
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// A group of upstreams and a balancer.
+type UpstreamPool struct {
+	// Upstreams.
+	Upstream []*Upstream
+	// Load balance strategy.
+	Balancer Balancer
+	// Health check config,nil means no check.
+	HealthCheck *HealthCheckData
+}
+
+// Create a new UpstreamPool.
+func NewUpstreamPool(data []*UpstreamData, balancer Balancer) (*UpstreamPool, error) {
+	upstream, err := newUpstreams(data)
+	if err != nil {
+		return nil, err
+	}
+	return &UpstreamPool{Upstream: upstream, Balancer: balancer}, nil
+}
+
+// Create upstreams by data.
+func newUpstreams(data []*UpstreamData) ([]*Upstream, error) {
+	if len(data) == 0 {
+		return nil, errors.New(`"upstream" must be defined`)
+	}
+	upstream := make([]*Upstream, 0, len(data))
+	for i, d := range data {
+		u, err := url.Parse(d.Url)
+		if err != nil {
+			return nil, fmt.Errorf(`"upstream[%d]" %s`, i, err.Error())
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf(`"upstream[%d]" invalid url "%s"`, i, d.Url)
+		}
+		weight := d.Weight
+		if weight < 1 {
+			weight = 1
+		}
+		upstream = append(upstream, &Upstream{Url: u, Weight: weight})
+	}
+	return upstream, nil
+}
+
+// Return an available upstream for request,or nil if all of them are unavailable.
+// Upstreams in exclude will not be selected,unless they are the only available ones.
+func (p *UpstreamPool) Next(c *Context, exclude ...*Upstream) *Upstream {
+	upstream := p.Upstream
+	for i, u := range p.Upstream {
+		if u.Available() && !upstreamIn(u, exclude) {
+			continue
+		}
+		// Filter unavailable upstreams.
+		upstream = make([]*Upstream, 0, len(p.Upstream))
+		upstream = append(upstream, p.Upstream[:i]...)
+		for _, u := range p.Upstream[i+1:] {
+			if u.Available() && !upstreamIn(u, exclude) {
+				upstream = append(upstream, u)
+			}
+		}
+		break
+	}
+	if len(upstream) < 1 {
+		if len(exclude) > 0 {
+			return p.Next(c)
+		}
+		return nil
+	}
+	return p.Balancer.Next(c, upstream)
+}
+
+func upstreamIn(u *Upstream, upstream []*Upstream) bool {
+	for _, v := range upstream {
+		if v == u {
+			return true
+		}
+	}
+	return false
+}
+
+// Return status of all upstreams.
+func (p *UpstreamPool) Status() []*UpstreamStatus {
+	status := make([]*UpstreamStatus, 0, len(p.Upstream))
+	for _, u := range p.Upstream {
+		status = append(status, u.Status())
+	}
+	return status
+}
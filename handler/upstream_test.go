@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func testUpstreamPool(t *testing.T, strategy, hashKey string, weight ...int) *UpstreamPool {
+	balancer, err := NewBalancer(strategy, hashKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []*UpstreamData
+	for i, w := range weight {
+		data = append(data, &UpstreamData{Url: fmt.Sprintf("http://127.0.0.1:%d", 3400+i), Weight: w})
+	}
+	pool, err := NewUpstreamPool(data, balancer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func testUpstreamCount(pool *UpstreamPool, c *Context, n int) map[*Upstream]int {
+	count := make(map[*Upstream]int)
+	for i := 0; i < n; i++ {
+		count[pool.Next(c)]++
+	}
+	return count
+}
+
+func Test_RoundRobinBalancer(t *testing.T) {
+	pool := testUpstreamPool(t, BalanceRoundRobin, "", 1, 5, 1)
+	count := testUpstreamCount(pool, new(Context), 30)
+	for _, u := range pool.Upstream {
+		if count[u] != 10 {
+			t.FailNow()
+		}
+	}
+}
+
+func Test_WeightedRoundRobinBalancer(t *testing.T) {
+	pool := testUpstreamPool(t, BalanceWeightedRoundRobin, "", 1, 5, 2)
+	count := testUpstreamCount(pool, new(Context), 80)
+	for _, u := range pool.Upstream {
+		if count[u] != u.Weight*10 {
+			t.FailNow()
+		}
+	}
+}
+
+func Test_LeastConnBalancer(t *testing.T) {
+	pool := testUpstreamPool(t, BalanceLeastConn, "", 1, 1, 1)
+	pool.Upstream[0].acquire()
+	pool.Upstream[2].acquire()
+	count := testUpstreamCount(pool, new(Context), 10)
+	if count[pool.Upstream[1]] != 10 {
+		t.FailNow()
+	}
+	pool = testUpstreamPool(t, BalanceRandom2, "", 1, 1)
+	pool.Upstream[0].acquire()
+	count = testUpstreamCount(pool, new(Context), 10)
+	if count[pool.Upstream[1]] != 10 {
+		t.FailNow()
+	}
+}
+
+func Test_HashBalancer(t *testing.T) {
+	_, err := NewBalancer(BalanceHash, "query")
+	if err == nil {
+		t.FailNow()
+	}
+	pool := testUpstreamPool(t, BalanceHash, "header:X-User", 1, 1, 1, 1)
+	c := new(Context)
+	c.Req = &http.Request{Header: make(http.Header)}
+	keys := make(map[string]*Upstream)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user%d", i)
+		c.Req.Header.Set("X-User", key)
+		keys[key] = pool.Next(c)
+		// Same key same upstream.
+		if pool.Next(c) != keys[key] {
+			t.FailNow()
+		}
+	}
+	// Remove one upstream,only it's keys will be remapped.
+	removed := pool.Upstream[1]
+	pool.Upstream = append(pool.Upstream[:1], pool.Upstream[2:]...)
+	for key, u := range keys {
+		c.Req.Header.Set("X-User", key)
+		if u != removed && pool.Next(c) != u {
+			t.FailNow()
+		}
+	}
+}
+
+func Test_DefaultForwarderUpstream(t *testing.T) {
+	h, err := NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{
+		RequestUrl: "http://127.0.0.1:3391",
+		Upstream:   []*UpstreamData{{Url: "http://127.0.0.1:3392", Weight: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := h.(*DefaultForwarder).Upstream()
+	if len(pool.Upstream) != 2 || pool.Upstream[0].Url.Host != "127.0.0.1:3391" || pool.Upstream[1].Weight != 2 {
+		t.FailNow()
+	}
+	// Only change balance strategy.
+	err = h.Update(&NewDefaultForwarderData{Balance: BalanceLeastConn, RequestTimeout: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.(*DefaultForwarder).Upstream().Upstream[0] != pool.Upstream[0] {
+		t.FailNow()
+	}
+	if _, ok := h.(*DefaultForwarder).Upstream().Balancer.(*leastConnBalancer); !ok {
+		t.FailNow()
+	}
+	_, err = NewHandler(DefaultForwarderName(), &NewDefaultForwarderData{})
+	if err == nil {
+		t.FailNow()
+	}
+}
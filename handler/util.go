@@ -1,6 +1,11 @@
 package handler
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
 
 // reurn dir top name.
 // Example: "/a/b" return "/a".
@@ -24,3 +29,52 @@ func Map2Struct(m map[string]interface{}, s interface{}) error {
 	// Second,convert json to struct.
 	return json.Unmarshal(data, s)
 }
+
+// Convert redis reply to int64.
+func redisInt(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case int:
+		return int64(n), nil
+	case string:
+		return strconv.ParseInt(n, 10, 64)
+	case []byte:
+		return strconv.ParseInt(string(n), 10, 64)
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("invalid redis reply type %s", reflect.TypeOf(v))
+	}
+}
+
+// Convert redis array reply to int64 array,which length must be n.
+func redisInts(v interface{}, n int) ([]int64, error) {
+	a, ok := v.([]interface{})
+	if !ok || len(a) != n {
+		return nil, fmt.Errorf("invalid redis reply %v", v)
+	}
+	r := make([]int64, n)
+	for i := range a {
+		var err error
+		r[i], err = redisInt(a[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Convert redis bulk string reply to string,nil reply is empty string.
+func redisString(v interface{}) (string, error) {
+	switch s := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return s, nil
+	case []byte:
+		return string(s), nil
+	default:
+		return "", fmt.Errorf("invalid redis reply type %s", reflect.TypeOf(v))
+	}
+}
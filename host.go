@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/qq51529210/gateway/handler"
+)
+
+// Virtual host initial data.
+type NewHostData struct {
+	// Host interceptor handler call chain.
+	// If it's empty,use DefaultInterceptor.
+	Intercept []NewHandlerData `json:"intercept"`
+	// Host notFound handler call chain.
+	// If it's empty,use DefaultNotFound.
+	NotFound []NewHandlerData `json:"notFound"`
+	// Host forward routes,key is route name.
+	Forward map[string]*NewForwardData `json:"forward"`
+}
+
+// A virtual host has it's own handler call chains and routes.
+type virtualHost struct {
+	// Host name,empty is default host.
+	name string
+	// Intercept chain.
+	intercept []handler.Handler
+	// Notfound chain.
+	notfound []handler.Handler
+	// Forward routes,key is route name.
+	route map[string]*route
+	// Lock for route.
+	routeLock sync.Mutex
+	// Sorted routes,value is routeTable.
+	routeTable atomic.Value
+}
+
+// Create a virtual host with empty chains and routes.
+func newVirtualHost(name string) *virtualHost {
+	h := new(virtualHost)
+	h.name = strings.ToLower(name)
+	h.route = make(map[string]*route)
+	h.routeTable.Store(routeTable{})
+	return h
+}
+
+// Create a virtual host by data.
+func newVirtualHostWithData(name string, data *NewHostData) (*virtualHost, error) {
+	h := newVirtualHost(name)
+	if data == nil {
+		data = new(NewHostData)
+	}
+	var err error
+	if len(data.Intercept) > 0 {
+		err = h.newIntercept(data.Intercept)
+		if err != nil {
+			h.Release()
+			return nil, fmt.Errorf(`"host"."%s" %s`, name, err.Error())
+		}
+	}
+	if len(data.NotFound) > 0 {
+		err = h.newNotFound(data.NotFound)
+		if err != nil {
+			h.Release()
+			return nil, fmt.Errorf(`"host"."%s" %s`, name, err.Error())
+		}
+	}
+	for k, v := range data.Forward {
+		err = h.newForward(k, v)
+		if err != nil {
+			h.Release()
+			return nil, fmt.Errorf(`"host"."%s" %s`, name, err.Error())
+		}
+	}
+	h.setDefault()
+	return h, nil
+}
+
+// Set default intercept and notfound chain if they are empty.
+func (h *virtualHost) setDefault() {
+	// Default interceptor handler.
+	if len(h.intercept) == 0 {
+		h.intercept = []handler.Handler{new(handler.DefaultInterceptor)}
+	}
+	// Default notFound handler.
+	if len(h.notfound) == 0 {
+		notfound, _ := handler.NewDefaultNotFound(nil)
+		h.notfound = []handler.Handler{notfound}
+	}
+}
+
+// Release all handlers.
+func (h *virtualHost) Release() {
+	for _, hd := range h.intercept {
+		hd.Release()
+	}
+	for _, hd := range h.notfound {
+		hd.Release()
+	}
+	h.routeLock.Lock()
+	for _, r := range h.route {
+		r.Release()
+	}
+	h.routeLock.Unlock()
+}
+
+// Call handler chains.
+func (h *virtualHost) Handle(ctx *handler.Context) {
+	// Match route first,so that interceptors know the route.
+	r := h.routeTable.Load().(routeTable).Match(ctx)
+	if r != nil {
+		ctx.Route = r.name
+		ctx.Path = r.StripPath()
+	}
+	// Intercept chain,route can inherit or override it.
+	if r == nil || !r.overrideIntercept {
+		for _, hd := range h.intercept {
+			if !hd.Handle(ctx) {
+				return
+			}
+		}
+	}
+	if r != nil {
+		for _, hd := range r.intercept {
+			if !hd.Handle(ctx) {
+				return
+			}
+		}
+	}
+	if r == nil {
+		// NotFound chain.
+		for _, hd := range h.notfound {
+			if !hd.Handle(ctx) {
+				break
+			}
+		}
+		return
+	}
+	// Forward chain,forwarder runs response chain.
+	ctx.SetResponseChain(r.response)
+	for _, hd := range r.forward {
+		if !hd.Handle(ctx) {
+			break
+		}
+	}
+}
+
+// Return upstream status of forwarders,key is route name.
+func (h *virtualHost) UpstreamStatus() map[string][]*handler.UpstreamStatus {
+	status := make(map[string][]*handler.UpstreamStatus)
+	h.routeLock.Lock()
+	for k, r := range h.route {
+		for _, hd := range r.forward {
+			if f, ok := hd.(interface{ Upstream() *handler.UpstreamPool }); ok {
+				status[k] = append(status[k], f.Upstream().Status()...)
+			}
+		}
+	}
+	h.routeLock.Unlock()
+	return status
+}
+
+// Setup forward route.
+func (h *virtualHost) newForward(name string, data *NewForwardData) error {
+	r, err := newRoute(name, data)
+	if err != nil {
+		return err
+	}
+	h.routeLock.Lock()
+	old := h.route[name]
+	h.route[name] = r
+	h.routeTable.Store(newRouteTable(h.route))
+	h.routeLock.Unlock()
+	if old != nil {
+		old.Release()
+	}
+	return nil
+}
+
+// Setup iterceptor chain.
+func (h *virtualHost) newIntercept(data []NewHandlerData) error {
+	if len(data) == 0 {
+		return errors.New(`"itercept" must define handler`)
+	}
+	for _, hd := range h.intercept {
+		hd.Release()
+	}
+	h.intercept = make([]handler.Handler, 0)
+	for i, a := range data {
+		hd, err := handler.NewHandler(a.Name, a.Data)
+		if err != nil {
+			return fmt.Errorf(`"itercept[%d]" %s`, i, err.Error())
+		}
+		h.intercept = append(h.intercept, hd)
+	}
+	return nil
+}
+
+// Setup notfound chain.
+func (h *virtualHost) newNotFound(data []NewHandlerData) error {
+	if len(data) == 0 {
+		return errors.New(`"notfound" must define handler`)
+	}
+	for _, hd := range h.notfound {
+		hd.Release()
+	}
+	h.notfound = make([]handler.Handler, 0)
+	for i, a := range data {
+		hd, err := handler.NewHandler(a.Name, a.Data)
+		if err != nil {
+			return fmt.Errorf(`"notfound[%d]" %s`, i, err.Error())
+		}
+		h.notfound = append(h.notfound, hd)
+	}
+	return nil
+}
+
+// Virtual hosts lookup table.
+type hostTable struct {
+	// Exact host,key is host name.
+	exact map[string]*virtualHost
+	// Wildcard host like "*.example.com",longer suffix first.
+	wildcard []*virtualHost
+}
+
+func newHostTable(hosts map[string]*virtualHost) *hostTable {
+	t := new(hostTable)
+	t.exact = make(map[string]*virtualHost)
+	for k, v := range hosts {
+		if strings.HasPrefix(k, "*.") {
+			t.wildcard = append(t.wildcard, v)
+		} else {
+			t.exact[k] = v
+		}
+	}
+	sort.Slice(t.wildcard, func(i, j int) bool {
+		return len(t.wildcard[i].name) > len(t.wildcard[j].name)
+	})
+	return t
+}
+
+// Return matched virtual host,or nil.
+func (t *hostTable) Match(req *http.Request) *virtualHost {
+	host := requestHost(req)
+	if h, ok := t.exact[host]; ok {
+		return h
+	}
+	for _, h := range t.wildcard {
+		// "*.example.com" -> ".example.com"
+		if strings.HasSuffix(host, h.name[1:]) {
+			return h
+		}
+	}
+	return nil
+}
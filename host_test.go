@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qq51529210/gateway/handler"
+)
+
+func Test_HostTable(t *testing.T) {
+	hosts := make(map[string]*virtualHost)
+	for _, name := range []string{"a.example.com", "*.example.com", "*.b.example.com"} {
+		h, err := newVirtualHostWithData(name, &NewHostData{
+			Forward: map[string]*NewForwardData{
+				"service1": {
+					Handler: []NewHandlerData{{Name: handler.DefaultInterceptorRegisterName()}},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts[h.name] = h
+	}
+	table := newHostTable(hosts)
+	for host, name := range map[string]string{
+		"a.example.com:80":  "a.example.com",
+		"A.Example.com":     "a.example.com",
+		"c.example.com":     "*.example.com",
+		"c.a.example.com":   "*.example.com",
+		"c.b.example.com":   "*.b.example.com",
+		"example.com":       "",
+		"a.example.com.org": "",
+	} {
+		h := table.Match(&http.Request{Host: host})
+		if (h == nil && name != "") || (h != nil && h.name != name) {
+			t.Fatal(host)
+		}
+	}
+	// Routes of virtual host.
+	req, _ := http.NewRequest(http.MethodGet, "http://c.example.com/service1/a", nil)
+	c := new(handler.Context)
+	c.Reset(nil, req)
+	table.Match(req).Handle(c)
+	if c.Route != "service1" || c.Path != "/service1" {
+		t.FailNow()
+	}
+}
+
+func Test_RouteIntercept(t *testing.T) {
+	marker := []NewHandlerData{{Name: handler.DefaultNotFoundRegisterName()}}
+	h, err := newVirtualHostWithData("", &NewHostData{
+		// Deny all.
+		Intercept: []NewHandlerData{{
+			Name: handler.AuthorizationInterceptorRegisterName(),
+			Data: &handler.AuthorizationInterceptorData{},
+		}},
+		Forward: map[string]*NewForwardData{
+			"private": {Handler: marker},
+			"public":  {InterceptMode: "override", Handler: marker},
+			"cors": {
+				InterceptMode: "override",
+				Intercept: []NewHandlerData{{
+					Name: handler.CORSHandlerRegisterName(),
+					Data: &handler.CORSHandlerData{AllowOrigin: []string{"*"}},
+				}},
+				Handler: marker,
+			},
+			"inherit": {
+				Intercept: []NewHandlerData{{
+					Name: handler.CORSHandlerRegisterName(),
+					Data: &handler.CORSHandlerData{AllowOrigin: []string{"*"}},
+				}},
+				Handler: marker,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	for path, v := range map[string]struct {
+		code int
+		cors bool
+	}{
+		"/private":  {http.StatusForbidden, false},
+		"/public":   {http.StatusNotFound, false},
+		"/cors":     {http.StatusNotFound, true},
+		"/inherit":  {http.StatusForbidden, false},
+		"/notfound": {http.StatusForbidden, false},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://a.example.com"+path, nil)
+		req.Header.Set("Origin", "https://b.example.com")
+		res := httptest.NewRecorder()
+		c := new(handler.Context)
+		c.Reset(res, req)
+		h.Handle(c)
+		if res.Code != v.code || (res.Header().Get("Access-Control-Allow-Origin") == "*") != v.cors {
+			t.Fatal(path)
+		}
+	}
+	// Invalid mode.
+	_, err = newRoute("a", &NewForwardData{InterceptMode: "replace", Handler: marker})
+	if err == nil {
+		t.FailNow()
+	}
+}
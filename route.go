@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/qq51529210/gateway/handler"
+)
+
+const (
+	// Request path has route path prefix.
+	routeMatchPrefix = "prefix"
+	// Request path equal to route path.
+	routeMatchExact = "exact"
+	// Route path has param like "/users/:id".
+	routeMatchParam = "param"
+	// Route path is regular expression.
+	routeMatchRegexp = "regexp"
+)
+
+const (
+	// Run host intercept chain,then route intercept chain.
+	routeInterceptInherit = "inherit"
+	// Run route intercept chain only.
+	routeInterceptOverride = "override"
+)
+
+// Forward route initial data.
+type NewForwardData struct {
+	// Route path pattern.
+	// If it's empty,use "/" + route name.
+	Path string `json:"path"`
+	// How to match request url path,"prefix","exact","param" or "regexp".
+	// If it's empty,"param" if Path has ":",else "prefix".
+	// Param value of "param" and named group of "regexp" will save in Context.Param.
+	Match string `json:"match"`
+	// Request host must be one of them.
+	// If it's empty,match all host.
+	Host []string `json:"host"`
+	// Request method must be one of them.
+	// If it's empty,match all method.
+	Method []string `json:"method"`
+	// Request header must has these value.
+	// Value "*" means header must exists.
+	Header map[string]string `json:"header"`
+	// Forward request url path unchanged.
+	// Otherwise,"prefix" route will remove path prefix before forward.
+	KeepPath bool `json:"keepPath"`
+	// Route interceptor handler call chain,runs after host intercept chain.
+	Intercept []NewHandlerData `json:"intercept"`
+	// How route intercept chain works with host intercept chain,"inherit" or "override".
+	// If it's empty,"inherit".
+	// "override" skips host intercept chain,route without "intercept" runs no interceptor.
+	InterceptMode string `json:"interceptMode"`
+	// Forward handler call chain.
+	Handler []NewHandlerData `json:"handler"`
+	// Response handler call chain,runs after upstream response is received.
+	// Handlers can modify Context.Response before it's written to client.
+	Response []NewHandlerData `json:"response"`
+}
+
+// Data can be a handler array,as a "prefix" route with the handler call chain.
+func (d *NewForwardData) UnmarshalJSON(data []byte) error {
+	var chain []NewHandlerData
+	if json.Unmarshal(data, &chain) == nil {
+		*d = NewForwardData{Handler: chain}
+		return nil
+	}
+	type forwardData NewForwardData
+	return json.Unmarshal(data, (*forwardData)(d))
+}
+
+// A forward route.
+type route struct {
+	// Route name.
+	name string
+	// Route path pattern.
+	path string
+	// Match mode.
+	match string
+	// Path segments of "param" route.
+	segment []string
+	// Path regular expression of "regexp" route.
+	regexp *regexp.Regexp
+	// Kinds of path segments,used to sort routes.
+	rank []int
+	// Host predicate.
+	host map[string]int
+	// Method predicate.
+	method map[string]int
+	// Header predicate.
+	header map[string]string
+	// Don't remove path prefix.
+	keepPath bool
+	// Skip host intercept chain.
+	overrideIntercept bool
+	// Route intercept chain.
+	intercept []handler.Handler
+	// Forward handler call chain.
+	forward []handler.Handler
+	// Response handler call chain.
+	response []handler.Handler
+}
+
+// Create a new route.
+func newRoute(name string, data *NewForwardData) (*route, error) {
+	if name == "" {
+		return nil, errors.New(`"forward"."route" must define`)
+	}
+	if data == nil || len(data.Handler) == 0 {
+		return nil, fmt.Errorf(`"forward"."%s" must define handler`, name)
+	}
+	r := new(route)
+	r.name = name
+	r.keepPath = data.KeepPath
+	// Path.
+	r.path = data.Path
+	if r.path == "" {
+		r.path = name
+	}
+	if r.path[0] != '/' {
+		r.path = "/" + r.path
+	}
+	// Match mode.
+	r.match = data.Match
+	if r.match == "" {
+		r.match = routeMatchPrefix
+		if strings.Contains(r.path, "/:") {
+			r.match = routeMatchParam
+		}
+	}
+	switch r.match {
+	case routeMatchPrefix, routeMatchExact:
+		if len(r.path) > 1 {
+			r.path = strings.TrimSuffix(r.path, "/")
+		}
+	case routeMatchParam:
+		r.segment = strings.Split(r.path[1:], "/")
+	case routeMatchRegexp:
+		exp, err := regexp.Compile("^(?:" + data.Path + ")$")
+		if err != nil {
+			return nil, fmt.Errorf(`"forward"."%s"."path" %s`, name, err.Error())
+		}
+		r.path = data.Path
+		r.regexp = exp
+	default:
+		return nil, fmt.Errorf(`"forward"."%s"."match" invalid value "%s"`, name, r.match)
+	}
+	r.rank = r.segmentRank()
+	// Predicates.
+	if len(data.Host) > 0 {
+		r.host = make(map[string]int)
+		for _, s := range data.Host {
+			r.host[strings.ToLower(s)] = 1
+		}
+	}
+	if len(data.Method) > 0 {
+		r.method = make(map[string]int)
+		for _, s := range data.Method {
+			r.method[strings.ToUpper(s)] = 1
+		}
+	}
+	if len(data.Header) > 0 {
+		r.header = make(map[string]string)
+		for k, v := range data.Header {
+			r.header[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	// Intercept chain.
+	switch data.InterceptMode {
+	case routeInterceptInherit, "":
+	case routeInterceptOverride:
+		r.overrideIntercept = true
+	default:
+		return nil, fmt.Errorf(`"forward"."%s"."interceptMode" invalid value "%s"`, name, data.InterceptMode)
+	}
+	for i, a := range data.Intercept {
+		hd, err := handler.NewHandler(a.Name, a.Data)
+		if err != nil {
+			r.Release()
+			return nil, fmt.Errorf(`"forward"."%s"."intercept"[%d] %s`, name, i, err.Error())
+		}
+		r.intercept = append(r.intercept, hd)
+	}
+	// Handler chain.
+	for i, a := range data.Handler {
+		hd, err := handler.NewHandler(a.Name, a.Data)
+		if err != nil {
+			r.Release()
+			return nil, fmt.Errorf(`"forward"."%s"[%d] %s`, name, i, err.Error())
+		}
+		r.forward = append(r.forward, hd)
+	}
+	// Response chain.
+	for i, a := range data.Response {
+		hd, err := handler.NewHandler(a.Name, a.Data)
+		if err != nil {
+			r.Release()
+			return nil, fmt.Errorf(`"forward"."%s"."response"[%d] %s`, name, i, err.Error())
+		}
+		r.response = append(r.response, hd)
+	}
+	return r, nil
+}
+
+// Release handler chains.
+func (r *route) Release() {
+	for _, h := range r.intercept {
+		h.Release()
+	}
+	for _, h := range r.forward {
+		h.Release()
+	}
+	for _, h := range r.response {
+		h.Release()
+	}
+}
+
+// Return true if request matched,and set c.Param.
+func (r *route) Match(c *handler.Context) bool {
+	// Predicates.
+	if r.host != nil {
+		if _, ok := r.host[requestHost(c.Req)]; !ok {
+			return false
+		}
+	}
+	if r.method != nil {
+		method := c.Req.Method
+		// CORS preflight matches the route of actual request.
+		if handler.IsCORSPreflight(c.Req) {
+			method = strings.ToUpper(c.Req.Header.Get("Access-Control-Request-Method"))
+		}
+		if _, ok := r.method[method]; !ok {
+			return false
+		}
+	}
+	for k, v := range r.header {
+		s, ok := c.Req.Header[k]
+		if !ok || (v != "*" && (len(s) < 1 || s[0] != v)) {
+			return false
+		}
+	}
+	// Path.
+	path := c.Req.URL.Path
+	switch r.match {
+	case routeMatchPrefix:
+		if r.path == "/" {
+			return true
+		}
+		return strings.HasPrefix(path, r.path) && (len(path) == len(r.path) || path[len(r.path)] == '/')
+	case routeMatchExact:
+		return path == r.path
+	case routeMatchParam:
+		if path == "" {
+			return false
+		}
+		segment := strings.Split(path[1:], "/")
+		if len(segment) != len(r.segment) {
+			return false
+		}
+		for i, s := range r.segment {
+			if s != "" && s[0] == ':' {
+				continue
+			}
+			if s != segment[i] {
+				return false
+			}
+		}
+		for i, s := range r.segment {
+			if s != "" && s[0] == ':' {
+				c.SetParam(s[1:], segment[i])
+			}
+		}
+		return true
+	default:
+		match := r.regexp.FindStringSubmatch(path)
+		if match == nil {
+			return false
+		}
+		for i, s := range r.regexp.SubexpNames() {
+			if s != "" {
+				c.SetParam(s, match[i])
+			}
+		}
+		return true
+	}
+}
+
+// Path prefix which forwarder will remove.
+func (r *route) StripPath() string {
+	if r.keepPath || r.match != routeMatchPrefix || r.path == "/" {
+		return ""
+	}
+	return r.path
+}
+
+const (
+	// Regular expression part of path.
+	segmentRegexp = iota
+	// Param segment like ":id".
+	segmentParam
+	// Literal segment.
+	segmentStatic
+)
+
+// Return kinds of path segments.
+// Literal prefix of "regexp" route are static segments,the rest is one regexp segment.
+func (r *route) segmentRank() []int {
+	path := r.path
+	complete := true
+	if r.regexp != nil {
+		path, complete = r.regexp.LiteralPrefix()
+		// Segment which literal prefix ends in is not static.
+		if !complete {
+			if i := strings.LastIndex(path, "/"); i >= 0 {
+				path = path[:i]
+			} else {
+				path = ""
+			}
+		}
+	}
+	var rank []int
+	if len(path) > 1 {
+		for _, s := range strings.Split(path[1:], "/") {
+			if s != "" && s[0] == ':' && r.match == routeMatchParam {
+				rank = append(rank, segmentParam)
+			} else {
+				rank = append(rank, segmentStatic)
+			}
+		}
+	}
+	if !complete {
+		rank = append(rank, segmentRegexp)
+	}
+	return rank
+}
+
+// Compare segment by segment,static segment first,than param segment,than regexp,
+// than more segments first.
+// Return positive if a is first,negative if b is first.
+func compareSegmentRank(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return len(a) - len(b)
+}
+
+// Return the number of predicates.
+func (r *route) predicates() int {
+	return len(r.host) + len(r.method) + len(r.header)
+}
+
+// Sorted routes.
+// "exact" route first,than more specific path segments first,than longer path first,than more predicates first.
+type routeTable []*route
+
+func newRouteTable(routes map[string]*route) routeTable {
+	t := make(routeTable, 0, len(routes))
+	for _, r := range routes {
+		t = append(t, r)
+	}
+	sort.Slice(t, func(i, j int) bool {
+		ie, je := t[i].match == routeMatchExact, t[j].match == routeMatchExact
+		if ie != je {
+			return ie
+		}
+		if n := compareSegmentRank(t[i].rank, t[j].rank); n != 0 {
+			return n > 0
+		}
+		if len(t[i].path) != len(t[j].path) {
+			return len(t[i].path) > len(t[j].path)
+		}
+		if t[i].predicates() != t[j].predicates() {
+			return t[i].predicates() > t[j].predicates()
+		}
+		return t[i].name < t[j].name
+	})
+	return t
+}
+
+// Return the first matched route,or nil.
+func (t routeTable) Match(c *handler.Context) *route {
+	for _, r := range t {
+		if r.Match(c) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Return lower case request host without port.
+func requestHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		host = req.Host
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/qq51529210/gateway/handler"
+)
+
+func testRouteTable(t *testing.T, data map[string]*NewForwardData) routeTable {
+	routes := make(map[string]*route)
+	for k, v := range data {
+		if len(v.Handler) == 0 {
+			v.Handler = []NewHandlerData{{Name: handler.DefaultInterceptorRegisterName()}}
+		}
+		r, err := newRoute(k, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes[k] = r
+	}
+	return newRouteTable(routes)
+}
+
+func testMatchRoute(t *testing.T, table routeTable, method, url string, header http.Header) *handler.Context {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	c := new(handler.Context)
+	c.Reset(nil, req)
+	r := table.Match(c)
+	if r != nil {
+		c.Route = r.name
+		c.Path = r.StripPath()
+	}
+	return c
+}
+
+func Test_RouteTable(t *testing.T) {
+	table := testRouteTable(t, map[string]*NewForwardData{
+		"api":      {Path: "/api"},
+		"v1":       {Path: "/api/v1"},
+		"v2":       {Path: "/api/v2", KeepPath: true},
+		"v2-users": {Path: "/api/v2/users", Match: "exact"},
+		"user":     {Path: "/api/v1/users/:id/books/:book"},
+		"regexp":   {Path: `/files/(?P<name>\w+)\.txt`, Match: "regexp"},
+		"host":     {Path: "/api/v1", Host: []string{"a.example.com"}},
+		"method":   {Path: "/api/v1", Method: []string{"post"}, Header: map[string]string{"X-Test": "*"}},
+		"me":       {Path: "/users/me"},
+		"userid":   {Path: "/users/:id"},
+		"version":  {Path: `/v[0-9]+/.*`, Match: "regexp"},
+		"static":   {Path: "/v1/static"},
+		"docs":     {Path: `/docs/st.*`, Match: "regexp"},
+		"doc":      {Path: "/docs/:name"},
+		"alt":      {Path: `/alt1|/alt2`, Match: "regexp"},
+	})
+	// Prefix
+	c := testMatchRoute(t, table, http.MethodGet, "http://b.example.com/api/v1/users", nil)
+	if c.Route != "v1" || c.Path != "/api/v1" {
+		t.FailNow()
+	}
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/api/v10", nil)
+	if c.Route != "api" || c.Path != "/api" {
+		t.FailNow()
+	}
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/api2", nil)
+	if c.Route != "" {
+		t.FailNow()
+	}
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/api/v2/books", nil)
+	if c.Route != "v2" || c.Path != "" {
+		t.FailNow()
+	}
+	// Exact
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/api/v2/users", nil)
+	if c.Route != "v2-users" || c.Path != "" {
+		t.FailNow()
+	}
+	// Param
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/api/v1/users/1/books/2", nil)
+	if c.Route != "user" || c.Param["id"] != "1" || c.Param["book"] != "2" {
+		t.FailNow()
+	}
+	// Static segment before param segment,both before regexp
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/users/me", nil)
+	if c.Route != "me" {
+		t.Fatal(c.Route)
+	}
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/users/1", nil)
+	if c.Route != "userid" || c.Param["id"] != "1" {
+		t.FailNow()
+	}
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/v1/static/a", nil)
+	if c.Route != "static" {
+		t.Fatal(c.Route)
+	}
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/v2/a", nil)
+	if c.Route != "version" {
+		t.FailNow()
+	}
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/docs/start", nil)
+	if c.Route != "doc" || c.Param["name"] != "start" {
+		t.Fatal(c.Route)
+	}
+	// Regexp
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/files/readme.txt", nil)
+	if c.Route != "regexp" || c.Param["name"] != "readme" {
+		t.FailNow()
+	}
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/alt2", nil)
+	if c.Route != "alt" {
+		t.FailNow()
+	}
+	c = testMatchRoute(t, table, http.MethodGet, "http://b.example.com/alt1xyz", nil)
+	if c.Route != "" {
+		t.FailNow()
+	}
+	// Predicates
+	c = testMatchRoute(t, table, http.MethodGet, "http://a.example.com:8080/api/v1", nil)
+	if c.Route != "host" {
+		t.FailNow()
+	}
+	c = testMatchRoute(t, table, http.MethodPost, "http://b.example.com/api/v1", nil)
+	if c.Route != "v1" {
+		t.FailNow()
+	}
+	c = testMatchRoute(t, table, http.MethodPost, "http://b.example.com/api/v1", http.Header{"X-Test": {"1"}})
+	if c.Route != "method" {
+		t.FailNow()
+	}
+	// CORS preflight
+	c = testMatchRoute(t, table, http.MethodOptions, "http://b.example.com/api/v1", http.Header{
+		"X-Test":                        {"1"},
+		"Origin":                        {"http://c.example.com"},
+		"Access-Control-Request-Method": {"POST"},
+	})
+	if c.Route != "method" {
+		t.FailNow()
+	}
+}
+
+func Test_NewForwardData(t *testing.T) {
+	var data map[string]*NewForwardData
+	err := json.Unmarshal([]byte(`{"a":[{"name":"n1"}],"b":{"path":"/b/:id","handler":[{"name":"n2"}]}}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["a"].Path != "" || data["a"].Handler[0].Name != "n1" {
+		t.FailNow()
+	}
+	if data["b"].Path != "/b/:id" || data["b"].Handler[0].Name != "n2" {
+		t.FailNow()
+	}
+}